@@ -5,16 +5,32 @@ import (
 	"MartellX/avito-tech-task/other"
 	"MartellX/avito-tech-task/repositories"
 	"MartellX/avito-tech-task/services"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/labstack/echo"
 	"gorm.io/gorm"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	neturl "net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Handler struct {
 	TaskService services.TaskService
 	Repo        repositories.Repository
+
+	// Не задан - обработчики расписаний отвечают 501
+	ScheduleService services.ScheduleService
+	// Максимальный размер загружаемого в POST /tasks файла, 0 - без ограничения. Тело запроса больше этого
+	// отклоняется, пока не прочитано целиком
+	MaxFileSize int64
 }
 
 func NewHandler(service services.TaskService, repo repositories.Repository) *Handler {
@@ -22,6 +38,14 @@ func NewHandler(service services.TaskService, repo repositories.Repository) *Han
 }
 
 func (h *Handler) NewTask(ctx echo.Context) error {
+	// Таблицу можно передать ссылкой или загрузить файлом в multipart/form-data
+	file, err := h.readUploadForm(ctx)
+	if err != nil {
+		if tooLarge(err) {
+			return fileTooLarge(ctx)
+		}
+		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
+	}
 	sellerId := ctx.FormValue("seller_id")
 	url := ctx.FormValue("url")
 
@@ -29,9 +53,14 @@ func (h *Handler) NewTask(ctx echo.Context) error {
 		return ctx.JSON(http.StatusBadRequest,
 			other.GetJsonStatusMessage(http.StatusBadRequest, "Не задан параметр seller_id"))
 	}
-	if url == "" {
+
+	if url == "" && file == nil {
+		return ctx.JSON(http.StatusBadRequest,
+			other.GetJsonStatusMessage(http.StatusBadRequest, "Не задан параметр url или file"))
+	}
+	if url != "" && file != nil {
 		return ctx.JSON(http.StatusBadRequest,
-			other.GetJsonStatusMessage(http.StatusBadRequest, "Не задан параметр url"))
+			other.GetJsonStatusMessage(http.StatusBadRequest, "Можно задать только один из параметров url и file"))
 	}
 
 	id, err := strconv.ParseUint(sellerId, 10, 64)
@@ -40,14 +69,267 @@ func (h *Handler) NewTask(ctx echo.Context) error {
 		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
 	}
 
-	task, err := h.TaskService.StartUploadingTask(id, url)
+	opts, err := parseTaskOptions(ctx)
 	if err != nil {
 		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
 	}
 
+	var task *services.Task
+	if file != nil {
+		task, err = h.startUploadingFileTask(id, file, opts)
+	} else {
+		task, err = h.TaskService.StartUploadingTask(id, url, opts)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrQueueFull):
+			ctx.Response().Header().Set("Retry-After", "60")
+			return ctx.JSON(http.StatusServiceUnavailable,
+				other.GetJsonStatusMessage(http.StatusServiceUnavailable, "Очередь заданий переполнена, повторите запрос позже"))
+		case tooLarge(err):
+			return fileTooLarge(ctx)
+		}
+		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
+	}
+
+	// Повтор запроса выполнен успешно, даже если само задание завершилось ошибкой: ее код есть в теле
+	if task.Replayed {
+		return ctx.JSONPretty(http.StatusOK, task, "\t")
+	}
 	return ctx.JSONPretty(task.StatusCode, task, "\t")
 }
 
+// Поля формы и заголовки частей multipart сверх самого файла
+const multipartOverhead = 1 << 20
+
+var (
+	errFormTooLarge    = errors.New("Поля формы превышают допустимый размер")
+	errFieldsAfterFile = errors.New("Поле file должно быть последним в форме")
+)
+
+// uploadPart - файл из multipart-формы, который читается прямо из тела запроса
+type uploadPart struct {
+	*multipart.Part
+	form *multipart.Reader
+}
+
+// Read читает файл. Поля после файла не были бы учтены, а задание уже было бы создано,
+// поэтому в таком случае чтение завершается ошибкой и задание не создается
+func (p *uploadPart) Read(b []byte) (int, error) {
+	n, err := p.Part.Read(b)
+	if err == io.EOF {
+		if _, nextErr := p.form.NextPart(); nextErr != io.EOF {
+			if nextErr == nil {
+				nextErr = errFieldsAfterFile
+			}
+			return n, nextErr
+		}
+	}
+	return n, err
+}
+
+// readUploadForm ограничивает тело запроса размером MaxFileSize с запасом на поля формы и читает поля
+// multipart-формы до файла. Сам файл не читается: задание получает его потоком и сохраняет сразу в свой каталог,
+// поэтому повтор запроса и переполненная очередь отклоняются до его загрузки. Возвращает nil, если файла нет
+func (h *Handler) readUploadForm(ctx echo.Context) (*uploadPart, error) {
+	req := ctx.Request()
+	if h.MaxFileSize > 0 {
+		limit := h.MaxFileSize + multipartOverhead
+		if req.ContentLength > limit {
+			return nil, services.ErrFileTooLarge
+		}
+		req.Body = http.MaxBytesReader(ctx.Response(), req.Body, limit)
+	}
+	if !strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		return nil, nil
+	}
+	form, err := req.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	// Для multipart ParseForm разбирает только параметры адреса, тело не читается
+	if err := req.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	values := make(neturl.Values)
+	remaining := int64(multipartOverhead)
+	var file *uploadPart
+	for file == nil {
+		part, err := form.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case part.FileName() == "":
+			value, err := ioutil.ReadAll(io.LimitReader(part, remaining+1))
+			if err != nil {
+				return nil, err
+			}
+			if remaining -= int64(len(value)); remaining < 0 {
+				return nil, errFormTooLarge
+			}
+			values.Add(part.FormName(), string(value))
+		case part.FormName() == "file":
+			file = &uploadPart{Part: part, form: form}
+		}
+		// Другие файлы пропускаются, NextPart дочитывает их сам
+	}
+	for name, v := range values {
+		req.Form[name] = append(req.Form[name], v...)
+		req.PostForm[name] = append(req.PostForm[name], v...)
+	}
+	req.MultipartForm = &multipart.Form{Value: values}
+	return file, nil
+}
+
+// tooLarge сообщает, что файл больше MaxFileSize или тело запроса оборвано на ограничении
+func tooLarge(err error) bool {
+	var maxBytes *http.MaxBytesError
+	return errors.Is(err, services.ErrFileTooLarge) || errors.As(err, &maxBytes)
+}
+
+func fileTooLarge(ctx echo.Context) error {
+	return ctx.JSON(http.StatusRequestEntityTooLarge,
+		other.GetJsonStatusMessage(http.StatusRequestEntityTooLarge, "Файл превышает допустимый размер"))
+}
+
+func (h *Handler) startUploadingFileTask(sellerId uint64, file *uploadPart, opts services.TaskOptions) (*services.Task, error) {
+	// Повтор запроса и переполненная очередь отклоняются до того, как файл прочитан
+	if task, err := h.TaskService.CheckNewTask(sellerId, opts.IdempotencyKey); task != nil || err != nil {
+		return task, err
+	}
+	return h.TaskService.StartUploadingFileTask(sellerId, services.UploadedFile{
+		Name:        file.FileName(),
+		ContentType: file.Header.Get(echo.HeaderContentType),
+		Body:        file,
+	}, opts)
+}
+
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	maxIdempotencyKeyLength = 255
+)
+
+// parseTaskOptions разбирает необязательные параметры задания
+func parseTaskOptions(ctx echo.Context) (services.TaskOptions, error) {
+	var opts services.TaskOptions
+
+	if dryRun := ctx.FormValue("dry_run"); dryRun != "" {
+		value, err := strconv.ParseBool(dryRun)
+		if err != nil {
+			return opts, fmt.Errorf("Недопустимое значение для параметра %s, ожидалось %T", "dry_run", value)
+		}
+		opts.DryRun = value
+	}
+
+	if atomic := ctx.FormValue("atomic"); atomic != "" {
+		value, err := strconv.ParseBool(atomic)
+		if err != nil {
+			return opts, fmt.Errorf("Недопустимое значение для параметра %s, ожидалось %T", "atomic", value)
+		}
+		opts.Atomic = value
+	}
+
+	if ratio := ctx.FormValue("max_error_ratio"); ratio != "" {
+		value, err := strconv.ParseFloat(ratio, 64)
+		if err != nil || value < 0 || value > 1 {
+			return opts, errors.New("Недопустимое значение для параметра max_error_ratio, ожидалось число от 0 до 1")
+		}
+		opts.MaxErrorRatio = value
+	}
+
+	switch mode := ctx.FormValue("mode"); mode {
+	case "", services.ModeMerge, services.ModeFullSync:
+		opts.Mode = mode
+	default:
+		return opts, fmt.Errorf("Недопустимое значение для параметра mode, ожидалось %s или %s", services.ModeMerge, services.ModeFullSync)
+	}
+
+	switch format := strings.ToLower(ctx.FormValue("format")); format {
+	case "", services.FormatXLSX, services.FormatCSV, services.FormatTSV, services.FormatJSON, services.FormatNDJSON:
+		opts.Format = format
+	default:
+		return opts, fmt.Errorf("Недопустимое значение для параметра format, ожидалось %s, %s, %s, %s или %s",
+			services.FormatXLSX, services.FormatCSV, services.FormatTSV, services.FormatJSON, services.FormatNDJSON)
+	}
+
+	if delimiter := ctx.FormValue("delimiter"); delimiter != "" {
+		if delimiter == `\t` || delimiter == "tab" {
+			delimiter = "\t"
+		}
+		runes := []rune(delimiter)
+		if len(runes) != 1 || runes[0] == '"' || runes[0] == '\r' || runes[0] == '\n' {
+			return opts, errors.New("Недопустимое значение для параметра delimiter, ожидался один символ")
+		}
+		opts.Delimiter = runes[0]
+	}
+
+	switch encoding := strings.ToLower(ctx.FormValue("encoding")); encoding {
+	case "":
+	case services.EncodingUTF8, "utf8":
+		opts.Encoding = services.EncodingUTF8
+	case services.EncodingWindows1251, "cp1251":
+		opts.Encoding = services.EncodingWindows1251
+	default:
+		return opts, fmt.Errorf("Недопустимое значение для параметра encoding, ожидалось %s или %s",
+			services.EncodingUTF8, services.EncodingWindows1251)
+	}
+
+	switch separator := ctx.FormValue("decimal_separator"); separator {
+	case "", ".":
+	case ",":
+		opts.DecimalSeparator = ','
+	default:
+		return opts, errors.New("Недопустимое значение для параметра decimal_separator, ожидалось . или ,")
+	}
+
+	// Сопоставление колонок задается парами колонка:название через запятую, например offer_id:Артикул,price:Цена
+	if columns := ctx.FormValue("columns"); columns != "" {
+		opts.Columns = map[string]string{}
+		for _, pair := range strings.Split(columns, ",") {
+			parts := strings.SplitN(pair, ":", 2)
+			column := strings.TrimSpace(parts[0])
+			if len(parts) != 2 || !services.KnownColumn(column) || strings.TrimSpace(parts[1]) == "" {
+				return opts, fmt.Errorf("Недопустимое значение для параметра columns: %q, ожидалось колонка:название", pair)
+			}
+			opts.Columns[column] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	// Лист книги: имя, номер начиная с 1 или * для всех листов
+	opts.Sheet = strings.TrimSpace(ctx.FormValue("sheet"))
+
+	if force := ctx.FormValue("force"); force != "" {
+		value, err := strconv.ParseBool(force)
+		if err != nil {
+			return opts, fmt.Errorf("Недопустимое значение для параметра %s, ожидалось %T", "force", value)
+		}
+		opts.Force = value
+	}
+
+	if callback := ctx.FormValue("callback_url"); callback != "" {
+		u, err := neturl.ParseRequestURI(callback)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return opts, errors.New("Недопустимое значение для параметра callback_url, ожидалась ссылка http или https")
+		}
+		opts.CallbackURL = callback
+	}
+
+	// Повтор запроса с тем же ключом возвращает уже созданное задание
+	if key := ctx.Request().Header.Get(idempotencyKeyHeader); key != "" {
+		if len(key) > maxIdempotencyKeyLength {
+			return opts, fmt.Errorf("Заголовок %s длиннее %d символов", idempotencyKeyHeader, maxIdempotencyKeyLength)
+		}
+		opts.IdempotencyKey = key
+	}
+
+	return opts, nil
+}
+
 func (h *Handler) GetTask(ctx echo.Context) error {
 	taskId := ctx.QueryParam("task_id")
 	if taskId == "" {
@@ -63,41 +345,309 @@ func (h *Handler) GetTask(ctx echo.Context) error {
 	return ctx.JSONPretty(http.StatusOK, task, "\t")
 }
 
-func (h *Handler) GetOffers(ctx echo.Context) error {
+func (h *Handler) CancelTask(ctx echo.Context) error {
+	taskId := ctx.QueryParam("task_id")
+	if taskId == "" {
+		return ctx.JSON(http.StatusBadRequest,
+			other.GetJsonStatusMessage(http.StatusBadRequest, "Не задан параметр task_id"))
+	}
 
-	sellerIdStr := ctx.QueryParam("seller_id")
-	offerIdStr := ctx.QueryParam("offer_id")
-	name := ctx.QueryParam("name")
+	task, err := h.TaskService.CancelTask(taskId)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTaskNotFound):
+			return ctx.JSON(http.StatusNotFound,
+				other.GetJsonStatusMessage(http.StatusNotFound, "Не найдено задание с таким id"))
+		case errors.Is(err, services.ErrTaskFinished):
+			return ctx.JSON(http.StatusConflict,
+				other.GetJsonStatusMessage(http.StatusConflict, "Задание уже завершено"))
+		default:
+			return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+		}
+	}
+	return ctx.JSONPretty(http.StatusOK, task, "\t")
+}
 
-	// Используются аргументы:
-	// seller_id uint
-	// offer_id uint
-	// name string
-	args := map[string]interface{}{}
+// Как часто отправлять комментарий в поток событий, чтобы прокси не закрывали соединение без данных
+const eventsKeepAlive = 15 * time.Second
 
-	if sellerIdStr != "" {
-		sellerId, err := strconv.ParseUint(sellerIdStr, 10, 64)
-		if err != nil {
-			return ctx.JSON(http.StatusBadRequest,
-				other.GetJsonStatusMessage(http.StatusBadRequest,
-					fmt.Sprintf("Недопустимое значение для параметра %s, ожидалось %T", "seller_id", sellerId)))
+// TaskEvents отдает события задания потоком Server-Sent Events: смену статуса и счетчики обработанных строк.
+// Поток закрывается после итогового статуса задания
+func (h *Handler) TaskEvents(ctx echo.Context) error {
+	events, unsubscribe, err := h.TaskService.SubscribeTask(ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrTaskNotFound) {
+			return ctx.JSON(http.StatusNotFound,
+				other.GetJsonStatusMessage(http.StatusNotFound, "Не найдено задание с таким id"))
+		}
+		return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+	}
+	defer unsubscribe()
+
+	res := ctx.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return nil
+			}
+			res.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case <-ctx.Request().Context().Done():
+			return nil
+		}
+	}
+}
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+
+	xlsxMIME = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// parsePagination разбирает параметры limit и offset, подставляя значения по умолчанию
+func parsePagination(ctx echo.Context) (limit, offset int, err error) {
+	limit = defaultPageLimit
+	if limitStr := ctx.QueryParam("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, fmt.Errorf("Недопустимое значение для параметра limit, ожидалось число от 1 до %d", maxPageLimit)
+		}
+	}
+	if offsetStr := ctx.QueryParam("offset"); offsetStr != "" {
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("Недопустимое значение для параметра offset, ожидалось неотрицательное число")
+		}
+	}
+	return limit, offset, nil
+}
+
+// GetTaskErrors возвращает ошибки строк задания постранично, а при format=xlsx - отчет со всеми ошибками
+func (h *Handler) GetTaskErrors(ctx echo.Context) error {
+	taskId := ctx.Param("id")
+	format := ctx.QueryParam("format")
+
+	limit, offset, err := parsePagination(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
+	}
+	if format == "xlsx" {
+		limit, offset = 0, 0
+	} else if format != "" && format != "json" {
+		return ctx.JSON(http.StatusBadRequest,
+			other.GetJsonStatusMessage(http.StatusBadRequest, "Недопустимое значение для параметра format, ожидалось json или xlsx"))
+	}
+
+	rowErrors, total, err := h.TaskService.GetTaskErrors(taskId, limit, offset)
+	if err != nil {
+		if errors.Is(err, services.ErrTaskNotFound) {
+			return ctx.JSON(http.StatusNotFound,
+				other.GetJsonStatusMessage(http.StatusNotFound, "Не найдено задание с таким id"))
 		}
-		args["seller_id"] = sellerId
+		return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
 	}
 
-	if offerIdStr != "" {
-		offerId, err := strconv.ParseUint(offerIdStr, 10, 64)
+	if format == "xlsx" {
+		report, err := services.BuildErrorsReport(rowErrors)
 		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+		}
+		var buf bytes.Buffer
+		if err := report.Write(&buf); err != nil {
+			return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+		}
+		ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"errors-%s.xlsx\"", taskId))
+		return ctx.Blob(http.StatusOK, xlsxMIME, buf.Bytes())
+	}
+
+	if rowErrors == nil {
+		rowErrors = []models.TaskRowError{}
+	}
+	result := struct {
+		Total  int64                 `json:"total"`
+		Limit  int                   `json:"limit"`
+		Offset int                   `json:"offset"`
+		Count  int                   `json:"count"`
+		Items  []models.TaskRowError `json:"items"`
+	}{total, limit, offset, len(rowErrors), rowErrors}
+
+	return ctx.JSONPretty(http.StatusOK, result, "\t")
+}
+
+// NewSchedule создает расписание импорта таблицы продавца по ссылке
+func (h *Handler) NewSchedule(ctx echo.Context) error {
+	if h.ScheduleService == nil {
+		return schedulesDisabled(ctx)
+	}
+	sellerId := ctx.FormValue("seller_id")
+	url := ctx.FormValue("url")
+	cron := ctx.FormValue("cron")
+
+	if sellerId == "" || url == "" || cron == "" {
+		return ctx.JSON(http.StatusBadRequest,
+			other.GetJsonStatusMessage(http.StatusBadRequest, "Не задан один из параметров seller_id, url, cron"))
+	}
+	id, err := strconv.ParseUint(sellerId, 10, 64)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
+	}
+	if u, err := neturl.ParseRequestURI(url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ctx.JSON(http.StatusBadRequest,
+			other.GetJsonStatusMessage(http.StatusBadRequest, "Недопустимое значение для параметра url, ожидалась ссылка http или https"))
+	}
+
+	schedule, err := h.ScheduleService.CreateSchedule(id, url, cron)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCron) {
 			return ctx.JSON(http.StatusBadRequest,
-				other.GetJsonStatusMessage(http.StatusBadRequest, fmt.Sprintf("Недопустимое значение для параметра %s, ожидалось %T", "offer_id", offerId)))
+				other.GetJsonStatusMessage(http.StatusBadRequest, "Недопустимое значение для параметра cron: "+err.Error()))
 		}
-		args["offer_id"] = offerId
+		return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+	}
+	return ctx.JSONPretty(http.StatusCreated, schedule, "\t")
+}
+
+// GetSchedules возвращает расписания продавца
+func (h *Handler) GetSchedules(ctx echo.Context) error {
+	if h.ScheduleService == nil {
+		return schedulesDisabled(ctx)
+	}
+	sellerIdStr := ctx.QueryParam("seller_id")
+	if sellerIdStr == "" {
+		return ctx.JSON(http.StatusBadRequest,
+			other.GetJsonStatusMessage(http.StatusBadRequest, "Не задан параметр seller_id"))
+	}
+	sellerId, err := strconv.ParseUint(sellerIdStr, 10, 64)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest,
+			other.GetJsonStatusMessage(http.StatusBadRequest,
+				fmt.Sprintf("Недопустимое значение для параметра %s, ожидалось %T", "seller_id", sellerId)))
+	}
+
+	schedules, err := h.ScheduleService.GetSchedules(sellerId)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+	}
+	if schedules == nil {
+		schedules = []models.Schedule{}
+	}
+	result := struct {
+		Count int               `json:"count"`
+		Items []models.Schedule `json:"items"`
+	}{len(schedules), schedules}
+
+	return ctx.JSONPretty(http.StatusOK, result, "\t")
+}
+
+// PauseSchedule приостанавливает расписание
+func (h *Handler) PauseSchedule(ctx echo.Context) error {
+	return h.setSchedulePaused(ctx, true)
+}
+
+// ResumeSchedule возобновляет приостановленное расписание
+func (h *Handler) ResumeSchedule(ctx echo.Context) error {
+	return h.setSchedulePaused(ctx, false)
+}
+
+func (h *Handler) setSchedulePaused(ctx echo.Context, paused bool) error {
+	if h.ScheduleService == nil {
+		return schedulesDisabled(ctx)
+	}
+	schedule, err := h.ScheduleService.PauseSchedule(ctx.Param("id"), paused)
+	if err != nil {
+		return scheduleError(ctx, err)
+	}
+	return ctx.JSONPretty(http.StatusOK, schedule, "\t")
+}
+
+// DeleteSchedule удаляет расписание, созданные по нему задания остаются
+func (h *Handler) DeleteSchedule(ctx echo.Context) error {
+	if h.ScheduleService == nil {
+		return schedulesDisabled(ctx)
 	}
-	if name != "" {
-		args["name"] = name
+	if err := h.ScheduleService.DeleteSchedule(ctx.Param("id")); err != nil {
+		return scheduleError(ctx, err)
 	}
+	return ctx.JSON(http.StatusOK, other.GetJsonStatusMessage(http.StatusOK, "Расписание удалено"))
+}
 
-	offers, err := h.Repo.FindOffersByConditions(args)
+// GetScheduleTasks возвращает постранично задания, созданные по расписанию, начиная с последнего
+func (h *Handler) GetScheduleTasks(ctx echo.Context) error {
+	if h.ScheduleService == nil {
+		return schedulesDisabled(ctx)
+	}
+	limit, offset, err := parsePagination(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
+	}
+
+	tasks, total, err := h.ScheduleService.GetScheduleTasks(ctx.Param("id"), limit, offset)
+	if err != nil {
+		return scheduleError(ctx, err)
+	}
+	if tasks == nil {
+		tasks = []models.Task{}
+	}
+	result := struct {
+		Total  int64         `json:"total"`
+		Limit  int           `json:"limit"`
+		Offset int           `json:"offset"`
+		Count  int           `json:"count"`
+		Items  []models.Task `json:"items"`
+	}{total, limit, offset, len(tasks), tasks}
+
+	return ctx.JSONPretty(http.StatusOK, result, "\t")
+}
+
+func scheduleError(ctx echo.Context, err error) error {
+	if errors.Is(err, services.ErrScheduleNotFound) {
+		return ctx.JSON(http.StatusNotFound,
+			other.GetJsonStatusMessage(http.StatusNotFound, "Не найдено расписание с таким id"))
+	}
+	return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+}
+
+func schedulesDisabled(ctx echo.Context) error {
+	return ctx.JSON(http.StatusNotImplemented,
+		other.GetJsonStatusMessage(http.StatusNotImplemented, "Расписания не поддерживаются"))
+}
+
+func (h *Handler) GetOffers(ctx echo.Context) error {
+
+	query, err := parseOfferQuery(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
+	}
+	if err := query.Validate(); err != nil {
+		return ctx.JSON(http.StatusBadRequest,
+			other.GetJsonStatusMessage(http.StatusBadRequest, "Недопустимые параметры поиска: "+err.Error()))
+	}
+
+	// Запрашивается на один товар больше, чтобы узнать, есть ли следующая страница
+	limit := query.Limit
+	query.Limit++
+	offers, err := h.Repo.FindOffers(query)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return ctx.JSON(http.StatusNotFound, other.GetJsonStatusMessage(http.StatusNotFound, "Ничего не найдено"))
@@ -106,11 +656,357 @@ func (h *Handler) GetOffers(ctx echo.Context) error {
 		}
 
 	}
+	total, err := h.Repo.CountOffers(query)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+	}
+
+	// Порядок по релевантности продолжается только по смещению
+	var nextCursor string
+	if len(offers) > limit {
+		offers = offers[:limit]
+		if !query.ByRelevance() {
+			nextCursor = encodeOfferCursor(offers[limit-1], query.Sort)
+		}
+	}
+	if offers == nil {
+		offers = []models.Offer{}
+	}
 
 	result := struct {
-		Count int            `json:"count"`
-		Items []models.Offer `json:"items"`
-	}{len(offers), offers}
+		Total      int64          `json:"total"`
+		Limit      int            `json:"limit"`
+		Offset     int            `json:"offset"`
+		Count      int            `json:"count"`
+		NextCursor string         `json:"next_cursor,omitempty"`
+		Items      []models.Offer `json:"items"`
+	}{total, limit, query.Offset, len(offers), nextCursor, offers}
 
 	return ctx.JSONPretty(http.StatusOK, result, "\t")
 }
+
+// parseOfferQuery разбирает параметры поиска товаров. Согласованность условий проверяет OfferQuery.Validate
+func parseOfferQuery(ctx echo.Context) (repositories.OfferQuery, error) {
+	var query repositories.OfferQuery
+
+	if value := ctx.QueryParam("seller_id"); value != "" {
+		sellerId, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return query, fmt.Errorf("Недопустимое значение для параметра %s, ожидалось %T", "seller_id", sellerId)
+		}
+		query.SellerId = &sellerId
+	}
+
+	if value := ctx.QueryParam("offer_id"); value != "" {
+		offerId, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return query, fmt.Errorf("Недопустимое значение для параметра %s, ожидалось %T", "offer_id", offerId)
+		}
+		query.OfferId = &offerId
+	}
+
+	query.Name = ctx.QueryParam("name")
+	query.Search = strings.TrimSpace(ctx.QueryParam("q"))
+
+	if value := ctx.QueryParam("price_min"); value != "" {
+		price, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return query, fmt.Errorf("Недопустимое значение для параметра %s, ожидалось %T", "price_min", price)
+		}
+		query.PriceMin = &price
+	}
+	if value := ctx.QueryParam("price_max"); value != "" {
+		price, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return query, fmt.Errorf("Недопустимое значение для параметра %s, ожидалось %T", "price_max", price)
+		}
+		query.PriceMax = &price
+	}
+
+	if value := ctx.QueryParam("quantity_min"); value != "" {
+		quantity, err := strconv.Atoi(value)
+		if err != nil {
+			return query, fmt.Errorf("Недопустимое значение для параметра %s, ожидалось %T", "quantity_min", quantity)
+		}
+		query.QuantityMin = &quantity
+	}
+
+	if value := ctx.QueryParam("available"); value != "" {
+		available, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, fmt.Errorf("Недопустимое значение для параметра %s, ожидалось %T", "available", available)
+		}
+		query.Available = &available
+	}
+
+	// Время в RFC 3339 или дата, тогда с начала суток UTC
+	if value := ctx.QueryParam("updated_since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			since, err = time.Parse("2006-01-02", value)
+		}
+		if err != nil {
+			return query, errors.New("Недопустимое значение для параметра updated_since, ожидалось время в формате RFC 3339 или дата ГГГГ-ММ-ДД")
+		}
+		query.UpdatedSince = &since
+	}
+
+	query.Sort = ctx.QueryParam("sort")
+
+	var err error
+	if query.Limit, query.Offset, err = parsePagination(ctx); err != nil {
+		return query, err
+	}
+	// Следующая страница запрашивается по курсору из next_cursor или по смещению, но не по обоим сразу.
+	// Курсор действует только для той же сортировки
+	if cursor := ctx.QueryParam("cursor"); cursor != "" {
+		if query.After, err = decodeOfferCursor(cursor, query.Sort); err != nil {
+			return query, errors.New("Недопустимое значение для параметра cursor")
+		}
+	}
+	return query, nil
+}
+
+// offerCursor - ключ последнего товара страницы и значение поля, по которому отсортированы товары
+type offerCursor struct {
+	Sort      string     `json:"s,omitempty"`
+	SellerId  uint64     `json:"k"`
+	OfferId   uint64     `json:"o"`
+	Price     int64      `json:"p,omitempty"`
+	Name      string     `json:"n,omitempty"`
+	UpdatedAt *time.Time `json:"u,omitempty"`
+}
+
+// encodeOfferCursor кодирует последний товар страницы в курсор следующей страницы
+func encodeOfferCursor(last models.Offer, sort string) string {
+	cursor := offerCursor{Sort: sort, SellerId: last.SellerId, OfferId: last.OfferId}
+	switch strings.TrimPrefix(sort, "-") {
+	case repositories.OfferSortPrice:
+		cursor.Price = last.Price
+	case repositories.OfferSortName:
+		cursor.Name = last.Name
+	case repositories.OfferSortUpdatedAt:
+		cursor.UpdatedAt = &last.UpdatedAt
+	}
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// decodeOfferCursor возвращает товар, после которого начинается страница. Курсор другой сортировки не подходит
+func decodeOfferCursor(encoded string, sort string) (*models.Offer, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var cursor offerCursor
+	if err := json.Unmarshal(decoded, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.Sort != sort {
+		return nil, errors.New("cursor belongs to another sort order")
+	}
+	after := &models.Offer{SellerId: cursor.SellerId, OfferId: cursor.OfferId, Price: cursor.Price, Name: cursor.Name}
+	if cursor.UpdatedAt != nil {
+		after.UpdatedAt = *cursor.UpdatedAt
+	}
+	return after, nil
+}
+
+// offerBody - товар в теле запросов /sellers/:seller_id/offers. Незаданные поля в PATCH не меняются
+type offerBody struct {
+	OfferId   *uint64 `json:"offer_id"`
+	Name      *string `json:"name"`
+	Price     *int64  `json:"price"`
+	Quantity  *int    `json:"quantity"`
+	Available *bool   `json:"available"`
+}
+
+// complete сообщает, заданы ли все поля товара, кроме offer_id
+func (b offerBody) complete() bool {
+	return b.Name != nil && b.Price != nil && b.Quantity != nil && b.Available != nil
+}
+
+// apply переносит заданные поля в товар
+func (b offerBody) apply(o *models.Offer) {
+	if b.Name != nil {
+		o.Name = *b.Name
+	}
+	if b.Price != nil {
+		o.Price = *b.Price
+	}
+	if b.Quantity != nil {
+		o.Quantity = *b.Quantity
+	}
+	if b.Available != nil {
+		o.Available = *b.Available
+	}
+}
+
+// GetOffer возвращает товар продавца
+func (h *Handler) GetOffer(ctx echo.Context) error {
+	sellerId, offerId, err := parseOfferPath(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
+	}
+	offer, err := h.Repo.FindOffer(offerId, sellerId)
+	if err != nil {
+		return offerError(ctx, err)
+	}
+	return ctx.JSONPretty(http.StatusOK, offer, "\t")
+}
+
+// NewOffer создает товар продавца, offer_id задается в теле. Существующий товар не перезаписывается
+func (h *Handler) NewOffer(ctx echo.Context) error {
+	sellerId, err := strconv.ParseUint(ctx.Param("seller_id"), 10, 64)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest,
+			other.GetJsonStatusMessage(http.StatusBadRequest,
+				fmt.Sprintf("Недопустимое значение для параметра %s, ожидалось %T", "seller_id", sellerId)))
+	}
+	body, err := parseOfferBody(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
+	}
+	if body.OfferId == nil || !body.complete() {
+		return ctx.JSON(http.StatusBadRequest,
+			other.GetJsonStatusMessage(http.StatusBadRequest, "Не задан один из параметров offer_id, name, price, quantity, available"))
+	}
+	offer := &models.Offer{OfferId: *body.OfferId, SellerId: sellerId}
+	body.apply(offer)
+	if err := validateOffer(offer); err != nil {
+		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
+	}
+
+	if _, err := h.Repo.FindOffer(offer.OfferId, sellerId); err == nil {
+		return offerExists(ctx)
+	} else if err != gorm.ErrRecordNotFound {
+		return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+	}
+	// Прошлый импорт того же файла больше не отражает товары продавца, повторная загрузка должна его применить
+	if err := h.Repo.MarkImportsStale(sellerId); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+	}
+	created, err := h.Repo.NewOffer(offer.OfferId, sellerId, offer.Name, offer.Price, offer.Quantity, offer.Available)
+	if err != nil {
+		// Товар мог создать параллельный запрос или импорт
+		if _, findErr := h.Repo.FindOffer(offer.OfferId, sellerId); findErr == nil {
+			return offerExists(ctx)
+		}
+		return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+	}
+
+	ctx.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/sellers/%d/offers/%d", sellerId, offer.OfferId))
+	return ctx.JSONPretty(http.StatusCreated, created, "\t")
+}
+
+// ReplaceOffer заменяет все поля существующего товара
+func (h *Handler) ReplaceOffer(ctx echo.Context) error {
+	return h.updateOffer(ctx, true)
+}
+
+// PatchOffer меняет только заданные в теле поля существующего товара
+func (h *Handler) PatchOffer(ctx echo.Context) error {
+	return h.updateOffer(ctx, false)
+}
+
+func (h *Handler) updateOffer(ctx echo.Context, replace bool) error {
+	sellerId, offerId, err := parseOfferPath(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
+	}
+	body, err := parseOfferBody(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
+	}
+	if body.OfferId != nil && *body.OfferId != offerId {
+		return ctx.JSON(http.StatusBadRequest,
+			other.GetJsonStatusMessage(http.StatusBadRequest, "offer_id в теле запроса не совпадает с offer_id в адресе"))
+	}
+	if replace && !body.complete() {
+		return ctx.JSON(http.StatusBadRequest,
+			other.GetJsonStatusMessage(http.StatusBadRequest, "Не задан один из параметров name, price, quantity, available"))
+	}
+
+	offer, err := h.Repo.FindOffer(offerId, sellerId)
+	if err != nil {
+		return offerError(ctx, err)
+	}
+	changed := *offer
+	body.apply(&changed)
+	if err := validateOffer(&changed); err != nil {
+		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
+	}
+	if err := h.Repo.MarkImportsStale(sellerId); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+	}
+	if err := h.Repo.UpdateColumns(offer, changed.Name, changed.Price, changed.Quantity, changed.Available); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+	}
+	return ctx.JSONPretty(http.StatusOK, offer, "\t")
+}
+
+// DeleteOffer удаляет товар продавца
+func (h *Handler) DeleteOffer(ctx echo.Context) error {
+	sellerId, offerId, err := parseOfferPath(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, other.GetJsonStatusMessage(http.StatusBadRequest, err.Error()))
+	}
+	offer, err := h.Repo.FindOffer(offerId, sellerId)
+	if err != nil {
+		return offerError(ctx, err)
+	}
+	if err := h.Repo.MarkImportsStale(sellerId); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+	}
+	if err := h.Repo.Delete(offer); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+	}
+	return ctx.JSON(http.StatusOK, other.GetJsonStatusMessage(http.StatusOK, "Товар удален"))
+}
+
+// parseOfferPath разбирает seller_id и offer_id из адреса товара
+func parseOfferPath(ctx echo.Context) (sellerId, offerId uint64, err error) {
+	sellerId, err = strconv.ParseUint(ctx.Param("seller_id"), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Недопустимое значение для параметра %s, ожидалось %T", "seller_id", sellerId)
+	}
+	offerId, err = strconv.ParseUint(ctx.Param("offer_id"), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Недопустимое значение для параметра %s, ожидалось %T", "offer_id", offerId)
+	}
+	return sellerId, offerId, nil
+}
+
+func parseOfferBody(ctx echo.Context) (offerBody, error) {
+	var body offerBody
+	decoder := json.NewDecoder(ctx.Request().Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil {
+		return body, fmt.Errorf("Недопустимое тело запроса, ожидался JSON товара: %v", err)
+	}
+	return body, nil
+}
+
+// validateOffer проверяет товар так же, как строки таблицы при импорте
+func validateOffer(o *models.Offer) error {
+	if o.Price < 0 {
+		return errors.New("Недопустимое значение для параметра price, ожидалось неотрицательное число")
+	}
+	if o.Quantity < 0 {
+		return errors.New("Недопустимое значение для параметра quantity, ожидалось неотрицательное число")
+	}
+	return nil
+}
+
+func offerError(ctx echo.Context, err error) error {
+	if err == gorm.ErrRecordNotFound {
+		return ctx.JSON(http.StatusNotFound,
+			other.GetJsonStatusMessage(http.StatusNotFound, "Не найден товар с таким offer_id у продавца"))
+	}
+	return ctx.JSON(http.StatusInternalServerError, "Непредвиденная ошибка")
+}
+
+func offerExists(ctx echo.Context) error {
+	return ctx.JSON(http.StatusConflict,
+		other.GetJsonStatusMessage(http.StatusConflict, "Товар с таким offer_id у продавца уже существует"))
+}
@@ -3,21 +3,28 @@ package controllers_test
 import (
 	"MartellX/avito-tech-task/controllers"
 	"MartellX/avito-tech-task/models"
+	"MartellX/avito-tech-task/repositories"
 	"MartellX/avito-tech-task/repositories/mock_repositories"
 	"MartellX/avito-tech-task/services"
 	"MartellX/avito-tech-task/services/mock_services"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo"
 	. "github.com/onsi/gomega"
+	"github.com/tealeg/xlsx"
 	"github.com/tidwall/gjson"
+	"gorm.io/gorm"
+	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestHandler_NewTask(t *testing.T) {
@@ -41,7 +48,7 @@ func TestHandler_NewTask(t *testing.T) {
 				c := e.NewContext(req, rec)
 
 				task := services.Task{StatusCode: http.StatusCreated}
-				s.EXPECT().StartUploadingTask(gomock.AssignableToTypeOf(uint64(1)), gomock.AssignableToTypeOf("str")).
+				s.EXPECT().StartUploadingTask(gomock.AssignableToTypeOf(uint64(1)), gomock.AssignableToTypeOf("str"), services.TaskOptions{}).
 					Return(&task, nil)
 
 				h := controllers.NewHandler(s, r)
@@ -53,6 +60,270 @@ func TestHandler_NewTask(t *testing.T) {
 				g.Expect(returnedTask).Should(Equal(task))
 			},
 		},
+		{
+			description: "if dry_run provided - passing it to service",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("seller_id", "1")
+				f.Set("url", "https://example.com")
+				f.Set("dry_run", "true")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				task := services.Task{StatusCode: http.StatusAccepted, DryRun: true}
+				s.EXPECT().StartUploadingTask(uint64(1), "https://example.com", services.TaskOptions{DryRun: true}).
+					Return(&task, nil)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusAccepted))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "dry_run").Bool()).Should(BeTrue())
+			},
+		},
+		{
+			description: "if atomic and max_error_ratio provided - passing them to service",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("seller_id", "1")
+				f.Set("url", "https://example.com")
+				f.Set("atomic", "true")
+				f.Set("max_error_ratio", "0.1")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				task := services.Task{StatusCode: http.StatusAccepted, Atomic: true}
+				s.EXPECT().StartUploadingTask(uint64(1), "https://example.com", services.TaskOptions{Atomic: true, MaxErrorRatio: 0.1}).
+					Return(&task, nil)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusAccepted))
+			},
+		},
+		{
+			description: "if max_error_ratio is out of range - return 400 and inform about that parameter",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("seller_id", "1")
+				f.Set("url", "https://example.com")
+				f.Set("max_error_ratio", "1.5")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("max_error_ratio"))
+			},
+		},
+		{
+			description: "if mode is unknown - return 400 and inform about that parameter",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("seller_id", "1")
+				f.Set("url", "https://example.com")
+				f.Set("mode", "replace")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("mode"))
+			},
+		},
+		{
+			description: "if csv parameters provided - passing them to service",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("seller_id", "1")
+				f.Set("url", "https://example.com")
+				f.Set("format", "CSV")
+				f.Set("delimiter", "tab")
+				f.Set("encoding", "cp1251")
+				f.Set("decimal_separator", ",")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				task := services.Task{StatusCode: http.StatusAccepted}
+				s.EXPECT().StartUploadingTask(uint64(1), "https://example.com", services.TaskOptions{
+					Format:           services.FormatCSV,
+					Delimiter:        '\t',
+					Encoding:         services.EncodingWindows1251,
+					DecimalSeparator: ',',
+				}).Return(&task, nil)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusAccepted))
+			},
+		},
+		{
+			description: "if columns and sheet provided - passing them to service",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("seller_id", "1")
+				f.Set("url", "https://example.com")
+				f.Set("columns", "offer_id:Артикул, price: Цена с НДС")
+				f.Set("sheet", services.AllSheets)
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				task := services.Task{StatusCode: http.StatusAccepted}
+				s.EXPECT().StartUploadingTask(uint64(1), "https://example.com", services.TaskOptions{
+					Columns: map[string]string{"offer_id": "Артикул", "price": "Цена с НДС"},
+					Sheet:   services.AllSheets,
+				}).Return(&task, nil)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusAccepted))
+			},
+		},
+		{
+			description: "if columns refer to unknown column - return 400 and inform about that parameter",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("seller_id", "1")
+				f.Set("url", "https://example.com")
+				f.Set("columns", "color:Цвет")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("columns"))
+			},
+		},
+		{
+			description: "if Idempotency-Key header, force and callback_url provided - passing them to service, replay returns 200",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("seller_id", "1")
+				f.Set("url", "https://example.com")
+				f.Set("force", "true")
+				f.Set("callback_url", "https://example.com/hook")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				req.Header.Set("Idempotency-Key", "retry-1")
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				// Повтор запроса для задания, завершившегося ошибкой
+				task := services.Task{Id: "1", StatusCode: http.StatusUnprocessableEntity, Replayed: true}
+				s.EXPECT().StartUploadingTask(uint64(1), "https://example.com", services.TaskOptions{
+					Force:          true,
+					IdempotencyKey: "retry-1",
+					CallbackURL:    "https://example.com/hook",
+				}).Return(&task, nil)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "status_code").Int()).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+			},
+		},
+		{
+			description: "if callback_url is not http link - return 400 and inform about that parameter",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("seller_id", "1")
+				f.Set("url", "https://example.com")
+				f.Set("callback_url", "ftp://example.com/hook")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("callback_url"))
+			},
+		},
+		{
+			description: "if encoding is unknown - return 400 and inform about that parameter",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("seller_id", "1")
+				f.Set("url", "https://example.com")
+				f.Set("encoding", "koi8-r")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("encoding"))
+			},
+		},
+		{
+			description: "if dry_run is not bool - return 400 and inform about that parameter",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("seller_id", "1")
+				f.Set("url", "https://example.com")
+				f.Set("dry_run", "maybe")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("dry_run"))
+			},
+		},
+		{
+			description: "if task queue is full - return code 503",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("seller_id", "1")
+				f.Set("url", "https://example.com")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				s.EXPECT().StartUploadingTask(gomock.AssignableToTypeOf(uint64(1)), gomock.AssignableToTypeOf("str"), services.TaskOptions{}).
+					Return(nil, services.ErrQueueFull)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusServiceUnavailable))
+				g.Expect(rec.Header().Get("Retry-After")).ShouldNot(BeEmpty())
+			},
+		},
 		{
 			description: "If seller_id not provided - return code 400 and inform about that parameter",
 			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
@@ -78,30 +349,513 @@ func TestHandler_NewTask(t *testing.T) {
 				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
 				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
 				rec := httptest.NewRecorder()
-				h := controllers.NewHandler(s, r)
+				h := controllers.NewHandler(s, r)
+				c := e.NewContext(req, rec)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(rec.Body).Should(ContainSubstring("url"))
+			},
+		},
+
+		{
+			description: "if file uploaded instead of url - passing it to service",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				req := newMultipartRequest(g, map[string]string{"seller_id": "1"}, "prices.xlsx", "content")
+				rec := httptest.NewRecorder()
+				h := controllers.NewHandler(s, r)
+				h.MaxFileSize = 1000
+				c := e.NewContext(req, rec)
+
+				task := services.Task{Id: "1", Status: "Queued", StatusCode: http.StatusAccepted}
+				s.EXPECT().CheckNewTask(uint64(1), "").Return(nil, nil)
+				s.EXPECT().StartUploadingFileTask(uint64(1), gomock.Any(), services.TaskOptions{}).
+					DoAndReturn(func(sellerId uint64, upload services.UploadedFile, opts services.TaskOptions) (*services.Task, error) {
+						g.Expect(upload.Name).Should(Equal("prices.xlsx"))
+						body, err := ioutil.ReadAll(upload.Body)
+						g.Expect(err).ShouldNot(HaveOccurred())
+						g.Expect(string(body)).Should(Equal("content"))
+						return &task, nil
+					})
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusAccepted))
+				g.Expect(gjson.Get(rec.Body.String(), "task_id").String()).Should(Equal("1"))
+			},
+		},
+		{
+			description: "if uploaded file is too large - return code 413",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				req := newMultipartRequest(g, map[string]string{"seller_id": "1"}, "prices.xlsx", "content")
+				rec := httptest.NewRecorder()
+				h := controllers.NewHandler(s, r)
+				c := e.NewContext(req, rec)
+
+				s.EXPECT().CheckNewTask(uint64(1), "").Return(nil, nil)
+				s.EXPECT().StartUploadingFileTask(uint64(1), gomock.Any(), gomock.Any()).
+					Return(nil, fmt.Errorf("%w: limit is 1 bytes", services.ErrFileTooLarge))
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusRequestEntityTooLarge))
+			},
+		},
+		{
+			description: "if request body is larger than max file size - return code 413 without reading it",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				h := controllers.NewHandler(s, r)
+				h.MaxFileSize = 1000
+				content := strings.Repeat("x", 2<<20)
+
+				req := newMultipartRequest(g, map[string]string{"seller_id": "1"}, "prices.xlsx", content)
+				rec := httptest.NewRecorder()
+				g.Expect(h.NewTask(e.NewContext(req, rec))).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusRequestEntityTooLarge))
+
+				// Размер заранее неизвестен: тело обрывается на ограничении, пока задание читает файл
+				req = newMultipartRequest(g, map[string]string{"seller_id": "1"}, "prices.xlsx", content)
+				req.ContentLength = -1
+				rec = httptest.NewRecorder()
+				s.EXPECT().CheckNewTask(uint64(1), "").Return(nil, nil)
+				s.EXPECT().StartUploadingFileTask(uint64(1), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(sellerId uint64, upload services.UploadedFile, opts services.TaskOptions) (*services.Task, error) {
+						_, err := ioutil.ReadAll(upload.Body)
+						g.Expect(err).Should(HaveOccurred())
+						return nil, err
+					})
+				g.Expect(h.NewTask(e.NewContext(req, rec))).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusRequestEntityTooLarge))
+			},
+		},
+		{
+			description: "if request is a replay or queue is full - answer before reading the file",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				h := controllers.NewHandler(s, r)
+
+				req := newMultipartRequest(g, map[string]string{"seller_id": "1"}, "prices.xlsx", "content")
+				req.Header.Set("Idempotency-Key", "retry-1")
+				rec := httptest.NewRecorder()
+				task := services.Task{Id: "1", StatusCode: http.StatusBadRequest, Replayed: true}
+				s.EXPECT().CheckNewTask(uint64(1), "retry-1").Return(&task, nil)
+				g.Expect(h.NewTask(e.NewContext(req, rec))).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				g.Expect(gjson.Get(rec.Body.String(), "task_id").String()).Should(Equal("1"))
+
+				req = newMultipartRequest(g, map[string]string{"seller_id": "1"}, "prices.xlsx", "content")
+				rec = httptest.NewRecorder()
+				s.EXPECT().CheckNewTask(uint64(1), "").Return(nil, services.ErrQueueFull)
+				g.Expect(h.NewTask(e.NewContext(req, rec))).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusServiceUnavailable))
+			},
+		},
+		{
+			description: "if form fields follow the file - return code 400 without creating task",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				body := &bytes.Buffer{}
+				w := multipart.NewWriter(body)
+				g.Expect(w.WriteField("seller_id", "1")).ShouldNot(HaveOccurred())
+				part, err := w.CreateFormFile("file", "prices.xlsx")
+				g.Expect(err).ShouldNot(HaveOccurred())
+				_, err = part.Write([]byte("content"))
+				g.Expect(err).ShouldNot(HaveOccurred())
+				g.Expect(w.WriteField("dry_run", "true")).ShouldNot(HaveOccurred())
+				g.Expect(w.Close()).ShouldNot(HaveOccurred())
+				req := httptest.NewRequest(http.MethodPost, "/", body)
+				req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+				rec := httptest.NewRecorder()
+				h := controllers.NewHandler(s, r)
+
+				s.EXPECT().CheckNewTask(uint64(1), "").Return(nil, nil)
+				s.EXPECT().StartUploadingFileTask(uint64(1), gomock.Any(), services.TaskOptions{}).
+					DoAndReturn(func(sellerId uint64, upload services.UploadedFile, opts services.TaskOptions) (*services.Task, error) {
+						_, err := ioutil.ReadAll(upload.Body)
+						return nil, err
+					})
+				g.Expect(h.NewTask(e.NewContext(req, rec))).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(gjson.Get(rec.Body.String(), "message").String()).Should(ContainSubstring("file"))
+			},
+		},
+		{
+			description: "if both url and file provided - return code 400",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				req := newMultipartRequest(g, map[string]string{"seller_id": "1", "url": "https://example.com"}, "prices.xlsx", "content")
+				rec := httptest.NewRecorder()
+				h := controllers.NewHandler(s, r)
+				c := e.NewContext(req, rec)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+			},
+		},
+
+		{
+			description: "If seller_id is not number - return 400 and error message",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("seller_id", "asd")
+				f.Set("url", "https://example.com")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				rec := httptest.NewRecorder()
+				h := controllers.NewHandler(s, r)
+				c := e.NewContext(req, rec)
+
+				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(rec.Body.String()).Should(ContainSubstring("message"))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		s := mock_services.NewMockTaskService(mockCtrl)
+		r := mock_repositories.NewMockRepository(mockCtrl)
+		fmt.Println(c.description)
+		c.expect(s, r)
+		fmt.Println("ok")
+
+	}
+}
+
+func newMultipartRequest(g *WithT, fields map[string]string, fileName string, content string) *http.Request {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	for k, v := range fields {
+		g.Expect(w.WriteField(k, v)).ShouldNot(HaveOccurred())
+	}
+	part, err := w.CreateFormFile("file", fileName)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	_, err = part.Write([]byte(content))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(w.Close()).ShouldNot(HaveOccurred())
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	return req
+}
+
+func TestHandler_GetTask(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+	e := echo.New()
+
+	cases := []struct {
+		description string
+		expect      func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository)
+	}{
+		{
+			description: "returning task by given id",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("task_id", "1")
+				req := httptest.NewRequest(http.MethodGet, "/?"+f.Encode(), nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				task := services.Task{}
+				s.EXPECT().GetTask(gomock.AssignableToTypeOf("string")).Return(&task, true)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.GetTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				var returnedTask services.Task
+				g.Expect(json.Unmarshal(rec.Body.Bytes(), &returnedTask)).ShouldNot(HaveOccurred())
+				g.Expect(returnedTask).Should(Equal(task))
+			},
+		},
+		{
+			description: "if task is not found - return error with NotFound code",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("task_id", "1")
+				req := httptest.NewRequest(http.MethodGet, "/?"+f.Encode(), nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				s.EXPECT().GetTask(gomock.AssignableToTypeOf("string")).Return(nil, false)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.GetTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusNotFound))
+			},
+		},
+		{
+			description: "if task_id is not provided - return error and inform",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.GetTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(rec.Body.String()).Should(ContainSubstring("task_id"))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		s := mock_services.NewMockTaskService(mockCtrl)
+		r := mock_repositories.NewMockRepository(mockCtrl)
+		fmt.Println(c.description)
+		c.expect(s, r)
+		fmt.Println("ok")
+
+	}
+}
+
+func TestHandler_CancelTask(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+	e := echo.New()
+
+	cases := []struct {
+		description string
+		expect      func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository)
+	}{
+		{
+			description: "returning cancelled task",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("task_id", "1")
+				req := httptest.NewRequest(http.MethodDelete, "/?"+f.Encode(), nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				task := services.Task{Id: "1", Status: "Cancelled"}
+				s.EXPECT().CancelTask("1").Return(&task, nil)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.CancelTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				var returnedTask services.Task
+				g.Expect(json.Unmarshal(rec.Body.Bytes(), &returnedTask)).ShouldNot(HaveOccurred())
+				g.Expect(returnedTask).Should(Equal(task))
+			},
+		},
+		{
+			description: "if task is not found - return error with NotFound code",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("task_id", "1")
+				req := httptest.NewRequest(http.MethodDelete, "/?"+f.Encode(), nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				s.EXPECT().CancelTask("1").Return(nil, services.ErrTaskNotFound)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.CancelTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusNotFound))
+			},
+		},
+		{
+			description: "if task is already finished - return error with Conflict code",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("task_id", "1")
+				req := httptest.NewRequest(http.MethodDelete, "/?"+f.Encode(), nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				s.EXPECT().CancelTask("1").Return(nil, services.ErrTaskFinished)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.CancelTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusConflict))
+			},
+		},
+		{
+			description: "if task_id is not provided - return error and inform",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				req := httptest.NewRequest(http.MethodDelete, "/", nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.CancelTask(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(rec.Body.String()).Should(ContainSubstring("task_id"))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		s := mock_services.NewMockTaskService(mockCtrl)
+		r := mock_repositories.NewMockRepository(mockCtrl)
+		fmt.Println(c.description)
+		c.expect(s, r)
+		fmt.Println("ok")
+
+	}
+}
+
+func TestHandler_TaskEvents(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+	e := echo.New()
+
+	cases := []struct {
+		description string
+		expect      func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository)
+	}{
+		{
+			description: "streaming events until channel is closed",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.SetParamNames("id")
+				c.SetParamValues("1")
+
+				events := make(chan services.TaskEvent, 2)
+				events <- services.TaskEvent{Type: services.EventProgress, Status: models.TaskStatusParsing, StatusCode: 102,
+					Processed: 100, Total: 200, Info: models.TaskInfo{Created: 100}}
+				events <- services.TaskEvent{Type: services.EventStatus, Status: models.TaskStatusCompleted, StatusCode: 200,
+					Processed: 200, Total: 200, Info: models.TaskInfo{Created: 200}}
+				close(events)
+				unsubscribed := false
+				s.EXPECT().SubscribeTask("1").Return((<-chan services.TaskEvent)(events), func() { unsubscribed = true }, nil)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.TaskEvents(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				g.Expect(rec.Header().Get(echo.HeaderContentType)).Should(Equal("text/event-stream"))
+				g.Expect(rec.Body.String()).Should(Equal(
+					"event: progress\n" +
+						`data: {"status":"Parsing","status_code":102,"processed":100,"total":200,"info":{"created":100}}` + "\n\n" +
+						"event: status\n" +
+						`data: {"status":"Completed","status_code":200,"processed":200,"total":200,"info":{"created":200}}` + "\n\n"))
+				g.Expect(unsubscribed).Should(BeTrue())
+			},
+		},
+		{
+			description: "if task is not found - return error with NotFound code",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.SetParamNames("id")
+				c.SetParamValues("1")
+
+				s.EXPECT().SubscribeTask("1").Return(nil, nil, services.ErrTaskNotFound)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.TaskEvents(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusNotFound))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		s := mock_services.NewMockTaskService(mockCtrl)
+		r := mock_repositories.NewMockRepository(mockCtrl)
+		fmt.Println(c.description)
+		c.expect(s, r)
+		fmt.Println("ok")
+	}
+}
+
+func TestHandler_GetTaskErrors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+	e := echo.New()
+
+	rowErrors := []models.TaskRowError{
+		{Row: 2, Column: "offer_id", Value: "a", Reason: models.RowErrorBadOfferId},
+		{Row: 5, Column: "price", Value: "-1", Reason: models.RowErrorNegativePrice},
+	}
+
+	cases := []struct {
+		description string
+		expect      func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository)
+	}{
+		{
+			description: "returning page of row errors",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("limit", "2")
+				f.Set("offset", "4")
+				req := httptest.NewRequest(http.MethodGet, "/?"+f.Encode(), nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.SetParamNames("id")
+				c.SetParamValues("1")
+
+				s.EXPECT().GetTaskErrors("1", 2, 4).Return(rowErrors, int64(6), nil)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.GetTaskErrors(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "total").Int()).Should(BeEquivalentTo(6))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "items").Array()).Should(HaveLen(2))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "items.1.reason").Str).Should(Equal(models.RowErrorNegativePrice))
+			},
+		},
+		{
+			description: "if format is xlsx - returning report with all errors",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("format", "xlsx")
+				req := httptest.NewRequest(http.MethodGet, "/?"+f.Encode(), nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.SetParamNames("id")
+				c.SetParamValues("1")
+
+				s.EXPECT().GetTaskErrors("1", 0, 0).Return(rowErrors, int64(2), nil)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.GetTaskErrors(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				g.Expect(rec.Header().Get(echo.HeaderContentDisposition)).Should(ContainSubstring(".xlsx"))
+				report, err := xlsx.OpenBinary(rec.Body.Bytes())
+				g.Expect(err).ShouldNot(HaveOccurred())
+				g.Expect(report.Sheets[0].Rows).Should(HaveLen(3))
+			},
+		},
+		{
+			description: "if task is not found - return error with NotFound code",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				rec := httptest.NewRecorder()
 				c := e.NewContext(req, rec)
+				c.SetParamNames("id")
+				c.SetParamValues("1")
 
-				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
-				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
-				g.Expect(rec.Body).Should(ContainSubstring("url"))
+				s.EXPECT().GetTaskErrors("1", gomock.Any(), gomock.Any()).Return(nil, int64(0), services.ErrTaskNotFound)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.GetTaskErrors(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusNotFound))
 			},
 		},
-
 		{
-			description: "If seller_id is not number - return 400 and error message",
+			description: "if limit is wrong - return error and inform",
 			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
 				f := make(url.Values)
-				f.Set("seller_id", "asd")
-				f.Set("url", "https://example.com")
-				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
-				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				f.Set("limit", "100000")
+				req := httptest.NewRequest(http.MethodGet, "/?"+f.Encode(), nil)
 				rec := httptest.NewRecorder()
-				h := controllers.NewHandler(s, r)
 				c := e.NewContext(req, rec)
+				c.SetParamNames("id")
+				c.SetParamValues("1")
 
-				g.Expect(h.NewTask(c)).ShouldNot(HaveOccurred())
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.GetTaskErrors(c)).ShouldNot(HaveOccurred())
 				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
-				g.Expect(rec.Body.String()).Should(ContainSubstring("message"))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("limit"))
 			},
 		},
 	}
@@ -116,76 +870,156 @@ func TestHandler_NewTask(t *testing.T) {
 	}
 }
 
-func TestHandler_GetTask(t *testing.T) {
+func TestHandler_Schedules(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	g := NewWithT(t)
 	e := echo.New()
 
+	newHandler := func(s *mock_services.MockScheduleService) *controllers.Handler {
+		h := controllers.NewHandler(mock_services.NewMockTaskService(mockCtrl), mock_repositories.NewMockRepository(mockCtrl))
+		h.ScheduleService = s
+		return h
+	}
+
 	cases := []struct {
 		description string
-		expect      func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository)
+		expect      func(s *mock_services.MockScheduleService)
 	}{
 		{
-			description: "returning task by given id",
-			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+			description: "if all params provided - returning new schedule",
+			expect: func(s *mock_services.MockScheduleService) {
 				f := make(url.Values)
-				f.Set("task_id", "1")
-				req := httptest.NewRequest(http.MethodGet, "/?"+f.Encode(), nil)
+				f.Set("seller_id", "1")
+				f.Set("url", "https://example.com/feed.xlsx")
+				f.Set("cron", "0 3 * * *")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
 				rec := httptest.NewRecorder()
 				c := e.NewContext(req, rec)
 
-				task := services.Task{}
-				s.EXPECT().GetTask(gomock.AssignableToTypeOf("string")).Return(&task, true)
+				s.EXPECT().CreateSchedule(uint64(1), "https://example.com/feed.xlsx", "0 3 * * *").
+					Return(&models.Schedule{Id: "s1", SellerId: 1, Cron: "0 3 * * *"}, nil)
 
-				h := controllers.NewHandler(s, r)
+				g.Expect(newHandler(s).NewSchedule(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusCreated))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "schedule_id").Str).Should(Equal("s1"))
+			},
+		},
+		{
+			description: "if cron is invalid - return error and inform",
+			expect: func(s *mock_services.MockScheduleService) {
+				f := make(url.Values)
+				f.Set("seller_id", "1")
+				f.Set("url", "https://example.com/feed.xlsx")
+				f.Set("cron", "nightly")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
 
-				g.Expect(h.GetTask(c)).ShouldNot(HaveOccurred())
-				g.Expect(rec.Code).Should(Equal(http.StatusOK))
-				var returnedTask services.Task
-				g.Expect(json.Unmarshal(rec.Body.Bytes(), &returnedTask)).ShouldNot(HaveOccurred())
-				g.Expect(returnedTask).Should(Equal(task))
+				s.EXPECT().CreateSchedule(uint64(1), "https://example.com/feed.xlsx", "nightly").
+					Return(nil, fmt.Errorf("%w: expected 5 fields, got 1", services.ErrInvalidCron))
+
+				g.Expect(newHandler(s).NewSchedule(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("cron"))
 			},
 		},
 		{
-			description: "if task is not found - return error with NotFound code",
-			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+			description: "if url is not http - return error and inform",
+			expect: func(s *mock_services.MockScheduleService) {
 				f := make(url.Values)
-				f.Set("task_id", "1")
-				req := httptest.NewRequest(http.MethodGet, "/?"+f.Encode(), nil)
+				f.Set("seller_id", "1")
+				f.Set("url", "file:///etc/passwd")
+				f.Set("cron", "0 3 * * *")
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(f.Encode()))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
 				rec := httptest.NewRecorder()
 				c := e.NewContext(req, rec)
-				s.EXPECT().GetTask(gomock.AssignableToTypeOf("string")).Return(nil, false)
 
-				h := controllers.NewHandler(s, r)
+				g.Expect(newHandler(s).NewSchedule(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("url"))
+			},
+		},
+		{
+			description: "returning seller schedules",
+			expect: func(s *mock_services.MockScheduleService) {
+				req := httptest.NewRequest(http.MethodGet, "/?seller_id=1", nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
 
-				g.Expect(h.GetTask(c)).ShouldNot(HaveOccurred())
-				g.Expect(rec.Code).Should(Equal(http.StatusNotFound))
+				s.EXPECT().GetSchedules(uint64(1)).Return([]models.Schedule{{Id: "s1"}, {Id: "s2", Paused: true}}, nil)
+
+				g.Expect(newHandler(s).GetSchedules(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "count").Int()).Should(BeEquivalentTo(2))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "items.1.paused").Bool()).Should(BeTrue())
 			},
 		},
 		{
-			description: "if task_id is not provided - return error and inform",
-			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+			description: "pausing and resuming schedule",
+			expect: func(s *mock_services.MockScheduleService) {
+				for _, paused := range []bool{true, false} {
+					req := httptest.NewRequest(http.MethodPost, "/", nil)
+					rec := httptest.NewRecorder()
+					c := e.NewContext(req, rec)
+					c.SetParamNames("id")
+					c.SetParamValues("s1")
 
-				req := httptest.NewRequest(http.MethodGet, "/", nil)
+					s.EXPECT().PauseSchedule("s1", paused).Return(&models.Schedule{Id: "s1", Paused: paused}, nil)
+
+					h := newHandler(s)
+					if paused {
+						g.Expect(h.PauseSchedule(c)).ShouldNot(HaveOccurred())
+					} else {
+						g.Expect(h.ResumeSchedule(c)).ShouldNot(HaveOccurred())
+					}
+					g.Expect(rec.Code).Should(Equal(http.StatusOK))
+					g.Expect(gjson.GetBytes(rec.Body.Bytes(), "paused").Bool()).Should(Equal(paused))
+				}
+			},
+		},
+		{
+			description: "if schedule is not found - return error with NotFound code",
+			expect: func(s *mock_services.MockScheduleService) {
+				req := httptest.NewRequest(http.MethodDelete, "/", nil)
 				rec := httptest.NewRecorder()
 				c := e.NewContext(req, rec)
+				c.SetParamNames("id")
+				c.SetParamValues("s1")
 
-				h := controllers.NewHandler(s, r)
+				s.EXPECT().DeleteSchedule("s1").Return(services.ErrScheduleNotFound)
 
-				g.Expect(h.GetTask(c)).ShouldNot(HaveOccurred())
-				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
-				g.Expect(rec.Body.String()).Should(ContainSubstring("task_id"))
+				g.Expect(newHandler(s).DeleteSchedule(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusNotFound))
+			},
+		},
+		{
+			description: "returning page of schedule tasks",
+			expect: func(s *mock_services.MockScheduleService) {
+				req := httptest.NewRequest(http.MethodGet, "/?limit=1", nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.SetParamNames("id")
+				c.SetParamValues("s1")
+
+				s.EXPECT().GetScheduleTasks("s1", 1, 0).
+					Return([]models.Task{{Id: "t2", Status: models.TaskStatusNoChanges, ScheduleId: "s1"}}, int64(2), nil)
+
+				g.Expect(newHandler(s).GetScheduleTasks(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "total").Int()).Should(BeEquivalentTo(2))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "items.0.task_id").Str).Should(Equal("t2"))
 			},
 		},
 	}
 
 	for _, c := range cases {
-		s := mock_services.NewMockTaskService(mockCtrl)
-		r := mock_repositories.NewMockRepository(mockCtrl)
+		s := mock_services.NewMockScheduleService(mockCtrl)
 		fmt.Println(c.description)
-		c.expect(s, r)
+		c.expect(s)
 		fmt.Println("ok")
-
 	}
 }
 
@@ -209,12 +1043,10 @@ func TestHandler_GetOffers(t *testing.T) {
 				rec := httptest.NewRecorder()
 				c := e.NewContext(req, rec)
 
-				expectingArgs := map[string]interface{}{
-					"offer_id":  uint64(1),
-					"seller_id": uint64(1),
-					"name":      "example",
-				}
-				r.EXPECT().FindOffersByConditions(expectingArgs).Return(make([]models.Offer, 3), nil)
+				offerId, sellerId := uint64(1), uint64(1)
+				expectingQuery := repositories.OfferQuery{OfferId: &offerId, SellerId: &sellerId, Name: "example", Limit: 101}
+				r.EXPECT().FindOffers(expectingQuery).Return(make([]models.Offer, 3), nil)
+				r.EXPECT().CountOffers(expectingQuery).Return(int64(3), nil)
 
 				h := controllers.NewHandler(s, r)
 
@@ -233,8 +1065,9 @@ func TestHandler_GetOffers(t *testing.T) {
 				rec := httptest.NewRecorder()
 				c := e.NewContext(req, rec)
 
-				expectingArgs := map[string]interface{}{}
-				r.EXPECT().FindOffersByConditions(expectingArgs).Return(make([]models.Offer, 3), nil)
+				expectingQuery := repositories.OfferQuery{Limit: 101}
+				r.EXPECT().FindOffers(expectingQuery).Return(make([]models.Offer, 3), nil)
+				r.EXPECT().CountOffers(expectingQuery).Return(int64(3), nil)
 
 				h := controllers.NewHandler(s, r)
 
@@ -277,6 +1110,180 @@ func TestHandler_GetOffers(t *testing.T) {
 				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("offer_id"))
 			},
 		},
+		{
+			description: "If there are more offers than limit -> returning page with next_cursor",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("seller_id", "7")
+				f.Set("limit", "2")
+				req := httptest.NewRequest(http.MethodGet, "/?"+f.Encode(), nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				sellerId := uint64(7)
+				expectingQuery := repositories.OfferQuery{SellerId: &sellerId, Limit: 3}
+				r.EXPECT().FindOffers(expectingQuery).
+					Return([]models.Offer{{SellerId: 7, OfferId: 1}, {SellerId: 7, OfferId: 5}, {SellerId: 7, OfferId: 9}}, nil)
+				r.EXPECT().CountOffers(expectingQuery).Return(int64(10), nil)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.GetOffers(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "total").Int()).Should(BeEquivalentTo(10))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "count").Int()).Should(BeEquivalentTo(2))
+				cursor := gjson.GetBytes(rec.Body.Bytes(), "next_cursor").Str
+				g.Expect(cursor).ShouldNot(BeEmpty())
+
+				// Следующая страница начинается после последнего товара
+				f.Set("cursor", cursor)
+				req = httptest.NewRequest(http.MethodGet, "/?"+f.Encode(), nil)
+				rec = httptest.NewRecorder()
+				c = e.NewContext(req, rec)
+
+				expectingQuery.After = &models.Offer{SellerId: 7, OfferId: 5}
+				r.EXPECT().FindOffers(expectingQuery).Return([]models.Offer{{SellerId: 7, OfferId: 9}}, nil)
+				r.EXPECT().CountOffers(expectingQuery).Return(int64(10), nil)
+
+				g.Expect(h.GetOffers(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "count").Int()).Should(BeEquivalentTo(1))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "next_cursor").Exists()).Should(BeFalse())
+			},
+		},
+		{
+			description: "If filters and sort provided -> passing them to repository, cursor keeps sort value",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("price_min", "100")
+				f.Set("price_max", "5000")
+				f.Set("quantity_min", "1")
+				f.Set("available", "true")
+				f.Set("updated_since", "2021-02-01")
+				f.Set("sort", "-price")
+				f.Set("limit", "1")
+				req := httptest.NewRequest(http.MethodGet, "/?"+f.Encode(), nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				priceMin, priceMax, quantityMin, available := int64(100), int64(5000), 1, true
+				since := time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+				expectingQuery := repositories.OfferQuery{
+					PriceMin:     &priceMin,
+					PriceMax:     &priceMax,
+					QuantityMin:  &quantityMin,
+					Available:    &available,
+					UpdatedSince: &since,
+					Sort:         "-price",
+					Limit:        2,
+				}
+				r.EXPECT().FindOffers(expectingQuery).
+					Return([]models.Offer{{SellerId: 1, OfferId: 3, Price: 4000}, {SellerId: 2, OfferId: 1, Price: 300}}, nil)
+				r.EXPECT().CountOffers(expectingQuery).Return(int64(2), nil)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.GetOffers(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				cursor := gjson.GetBytes(rec.Body.Bytes(), "next_cursor").Str
+				g.Expect(cursor).ShouldNot(BeEmpty())
+
+				f.Set("cursor", cursor)
+				req = httptest.NewRequest(http.MethodGet, "/?"+f.Encode(), nil)
+				rec = httptest.NewRecorder()
+				c = e.NewContext(req, rec)
+
+				expectingQuery.After = &models.Offer{SellerId: 1, OfferId: 3, Price: 4000}
+				r.EXPECT().FindOffers(expectingQuery).Return([]models.Offer{{SellerId: 2, OfferId: 1, Price: 300}}, nil)
+				r.EXPECT().CountOffers(expectingQuery).Return(int64(2), nil)
+
+				g.Expect(h.GetOffers(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+
+				// Курсор другой сортировки не подходит
+				f.Set("sort", "name")
+				req = httptest.NewRequest(http.MethodGet, "/?"+f.Encode(), nil)
+				rec = httptest.NewRecorder()
+				c = e.NewContext(req, rec)
+
+				g.Expect(h.GetOffers(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("cursor"))
+			},
+		},
+		{
+			description: "If q provided -> searching by relevance, paging only by offset",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				f := make(url.Values)
+				f.Set("q", " iphone 12 ")
+				f.Set("limit", "1")
+				req := httptest.NewRequest(http.MethodGet, "/?"+f.Encode(), nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				expectingQuery := repositories.OfferQuery{Search: "iphone 12", Limit: 2}
+				r.EXPECT().FindOffers(expectingQuery).
+					Return([]models.Offer{{SellerId: 1, OfferId: 3, Name: "iPhone 12"}, {SellerId: 2, OfferId: 1, Name: "iPhone 11"}}, nil)
+				r.EXPECT().CountOffers(expectingQuery).Return(int64(2), nil)
+
+				h := controllers.NewHandler(s, r)
+
+				g.Expect(h.GetOffers(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "items.0.name").Str).Should(Equal("iPhone 12"))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "next_cursor").Exists()).Should(BeFalse())
+
+				// Без слов искать нечего
+				req = httptest.NewRequest(http.MethodGet, "/?q=%2A%26", nil)
+				rec = httptest.NewRecorder()
+				c = e.NewContext(req, rec)
+
+				g.Expect(h.GetOffers(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("q has no words"))
+			},
+		},
+		{
+			description: "If filter or sort is wrong -> return error message with parameter name",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				cases := map[string]string{
+					"price_min=-1":             "price_min",
+					"price_max=abc":            "price_max",
+					"price_min=10&price_max=5": "price_min",
+					"quantity_min=1.5":         "quantity_min",
+					"available=maybe":          "available",
+					"updated_since=yesterday":  "updated_since",
+					"sort=quantity":            "sort",
+					"sort=-":                   "sort",
+				}
+				for query, param := range cases {
+					req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+					rec := httptest.NewRecorder()
+					c := e.NewContext(req, rec)
+
+					h := controllers.NewHandler(s, r)
+
+					g.Expect(h.GetOffers(c)).ShouldNot(HaveOccurred())
+					g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+					g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring(param))
+				}
+			},
+		},
+		{
+			description: "If cursor is malformed or combined with offset -> return error message",
+			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
+				for _, query := range []string{"cursor=%21%21", "cursor=eyJrIjoxLCJvIjoxfQ&offset=10", "limit=5000"} {
+					req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+					rec := httptest.NewRecorder()
+					c := e.NewContext(req, rec)
+
+					h := controllers.NewHandler(s, r)
+
+					g.Expect(h.GetOffers(c)).ShouldNot(HaveOccurred())
+					g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				}
+			},
+		},
 		{
 			description: "If error occurred -> return 500 code",
 			expect: func(s *mock_services.MockTaskService, r *mock_repositories.MockRepository) {
@@ -285,8 +1292,7 @@ func TestHandler_GetOffers(t *testing.T) {
 				rec := httptest.NewRecorder()
 				c := e.NewContext(req, rec)
 
-				expectingArgs := map[string]interface{}{}
-				r.EXPECT().FindOffersByConditions(expectingArgs).Return(nil, errors.New("sample"))
+				r.EXPECT().FindOffers(repositories.OfferQuery{Limit: 101}).Return(nil, errors.New("sample"))
 
 				h := controllers.NewHandler(s, r)
 
@@ -306,3 +1312,216 @@ func TestHandler_GetOffers(t *testing.T) {
 
 	}
 }
+
+func TestHandler_Offers(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+	e := echo.New()
+
+	// Запрос к /sellers/:seller_id/offers/:offer_id, для POST offer_id не задается
+	newContext := func(method, body string, params ...string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("seller_id", "offer_id")
+		c.SetParamValues(params...)
+		return c, rec
+	}
+	// UpdateColumns репозитория меняет переданный товар
+	updateColumns := func(o *models.Offer, name string, price int64, quantity int, available bool) error {
+		o.Name, o.Price, o.Quantity, o.Available = name, price, quantity, available
+		return nil
+	}
+
+	cases := []struct {
+		description string
+		expect      func(r *mock_repositories.MockRepository)
+	}{
+		{
+			description: "GET existing offer -> returning it",
+			expect: func(r *mock_repositories.MockRepository) {
+				c, rec := newContext(http.MethodGet, "", "2", "10")
+				r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(&models.Offer{OfferId: 10, SellerId: 2, Name: "iPhone", Price: 100}, nil)
+
+				h := controllers.NewHandler(nil, r)
+
+				g.Expect(h.GetOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "name").Str).Should(Equal("iPhone"))
+			},
+		},
+		{
+			description: "GET missing offer -> 404, malformed id -> 400, database error -> 500",
+			expect: func(r *mock_repositories.MockRepository) {
+				h := controllers.NewHandler(nil, r)
+
+				c, rec := newContext(http.MethodGet, "", "2", "10")
+				r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(nil, gorm.ErrRecordNotFound)
+				g.Expect(h.GetOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusNotFound))
+
+				c, rec = newContext(http.MethodGet, "", "2", "abc")
+				g.Expect(h.GetOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("offer_id"))
+
+				c, rec = newContext(http.MethodGet, "", "2", "10")
+				r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(nil, errors.New("sample"))
+				g.Expect(h.GetOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusInternalServerError))
+			},
+		},
+		{
+			description: "POST new offer -> 201 with location",
+			expect: func(r *mock_repositories.MockRepository) {
+				c, rec := newContext(http.MethodPost, `{"offer_id": 10, "name": "iPhone", "price": 100, "quantity": 0, "available": false}`, "2")
+				r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(nil, gorm.ErrRecordNotFound)
+				r.EXPECT().MarkImportsStale(uint64(2)).Return(nil)
+				r.EXPECT().NewOffer(uint64(10), uint64(2), "iPhone", int64(100), 0, false).
+					Return(&models.Offer{OfferId: 10, SellerId: 2, Name: "iPhone", Price: 100}, nil)
+
+				h := controllers.NewHandler(nil, r)
+
+				g.Expect(h.NewOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusCreated))
+				g.Expect(rec.Header().Get(echo.HeaderLocation)).Should(Equal("/sellers/2/offers/10"))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "offer_id").Uint()).Should(BeEquivalentTo(10))
+			},
+		},
+		{
+			description: "POST existing offer -> 409, also when it was created concurrently",
+			expect: func(r *mock_repositories.MockRepository) {
+				body := `{"offer_id": 10, "name": "iPhone", "price": 100, "quantity": 1, "available": true}`
+				h := controllers.NewHandler(nil, r)
+
+				c, rec := newContext(http.MethodPost, body, "2")
+				r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(&models.Offer{OfferId: 10, SellerId: 2}, nil)
+				g.Expect(h.NewOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusConflict))
+
+				c, rec = newContext(http.MethodPost, body, "2")
+				gomock.InOrder(
+					r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(nil, gorm.ErrRecordNotFound),
+					r.EXPECT().MarkImportsStale(uint64(2)).Return(nil),
+					r.EXPECT().NewOffer(uint64(10), uint64(2), "iPhone", int64(100), 1, true).Return(nil, errors.New("duplicate key")),
+					r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(&models.Offer{OfferId: 10, SellerId: 2}, nil),
+				)
+				g.Expect(h.NewOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusConflict))
+			},
+		},
+		{
+			description: "POST invalid offer -> 400 without touching repository",
+			expect: func(r *mock_repositories.MockRepository) {
+				cases := map[string]string{
+					`{"offer_id": 10, "name": "a", "price": -1, "quantity": 1, "available": true}`:  "price",
+					`{"offer_id": 10, "name": "a", "price": 1, "quantity": -5, "available": true}`:  "quantity",
+					`{"name": "a", "price": 1, "quantity": 1, "available": true}`:                   "offer_id",
+					`{"offer_id": 10, "name": "a", "price": "1", "quantity": 1, "available": true}`: "JSON",
+					`{"offer_id": 10, "title": "a"}`:                                                "title",
+				}
+				h := controllers.NewHandler(nil, r)
+				for body, param := range cases {
+					c, rec := newContext(http.MethodPost, body, "2")
+
+					g.Expect(h.NewOffer(c)).ShouldNot(HaveOccurred())
+					g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+					g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring(param))
+				}
+			},
+		},
+		{
+			description: "PUT replaces all fields, PATCH only provided ones",
+			expect: func(r *mock_repositories.MockRepository) {
+				h := controllers.NewHandler(nil, r)
+
+				c, rec := newContext(http.MethodPut, `{"name": "iPhone 12", "price": 500, "quantity": 3, "available": true}`, "2", "10")
+				offer := &models.Offer{OfferId: 10, SellerId: 2, Name: "iPhone", Price: 100}
+				r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(offer, nil)
+				r.EXPECT().MarkImportsStale(uint64(2)).Return(nil)
+				r.EXPECT().UpdateColumns(offer, "iPhone 12", int64(500), 3, true).DoAndReturn(updateColumns)
+				g.Expect(h.ReplaceOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "price").Int()).Should(BeEquivalentTo(500))
+
+				c, rec = newContext(http.MethodPatch, `{"quantity": 0, "available": false}`, "2", "10")
+				offer = &models.Offer{OfferId: 10, SellerId: 2, Name: "iPhone", Price: 100, Quantity: 4, Available: true}
+				r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(offer, nil)
+				r.EXPECT().MarkImportsStale(uint64(2)).Return(nil)
+				r.EXPECT().UpdateColumns(offer, "iPhone", int64(100), 0, false).DoAndReturn(updateColumns)
+				g.Expect(h.PatchOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "name").Str).Should(Equal("iPhone"))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "available").Bool()).Should(BeFalse())
+			},
+		},
+		{
+			description: "PUT or PATCH with wrong body or missing offer -> error without update",
+			expect: func(r *mock_repositories.MockRepository) {
+				h := controllers.NewHandler(nil, r)
+
+				// PUT требует все поля
+				c, rec := newContext(http.MethodPut, `{"price": 500}`, "2", "10")
+				g.Expect(h.ReplaceOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+
+				c, rec = newContext(http.MethodPatch, `{"offer_id": 11, "price": 500}`, "2", "10")
+				g.Expect(h.PatchOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("offer_id"))
+
+				c, rec = newContext(http.MethodPatch, `{"price": -500}`, "2", "10")
+				r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(&models.Offer{OfferId: 10, SellerId: 2}, nil)
+				g.Expect(h.PatchOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusBadRequest))
+				g.Expect(gjson.GetBytes(rec.Body.Bytes(), "message").Str).Should(ContainSubstring("price"))
+
+				c, rec = newContext(http.MethodPatch, `{"price": 500}`, "2", "10")
+				r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(nil, gorm.ErrRecordNotFound)
+				g.Expect(h.PatchOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusNotFound))
+			},
+		},
+		{
+			description: "DELETE existing offer -> deleting, missing -> 404, database error -> 500",
+			expect: func(r *mock_repositories.MockRepository) {
+				h := controllers.NewHandler(nil, r)
+
+				c, rec := newContext(http.MethodDelete, "", "2", "10")
+				offer := &models.Offer{OfferId: 10, SellerId: 2}
+				r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(offer, nil)
+				r.EXPECT().MarkImportsStale(uint64(2)).Return(nil)
+				r.EXPECT().Delete(offer).Return(nil)
+				g.Expect(h.DeleteOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusOK))
+
+				c, rec = newContext(http.MethodDelete, "", "2", "10")
+				r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(offer, nil)
+				r.EXPECT().MarkImportsStale(uint64(2)).Return(nil)
+				r.EXPECT().Delete(offer).Return(errors.New("sample"))
+				g.Expect(h.DeleteOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusInternalServerError))
+
+				// Без пометки прошлых импортов товар не удаляется
+				c, rec = newContext(http.MethodDelete, "", "2", "10")
+				r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(offer, nil)
+				r.EXPECT().MarkImportsStale(uint64(2)).Return(errors.New("sample"))
+				g.Expect(h.DeleteOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusInternalServerError))
+
+				c, rec = newContext(http.MethodDelete, "", "2", "10")
+				r.EXPECT().FindOffer(uint64(10), uint64(2)).Return(nil, gorm.ErrRecordNotFound)
+				g.Expect(h.DeleteOffer(c)).ShouldNot(HaveOccurred())
+				g.Expect(rec.Code).Should(Equal(http.StatusNotFound))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		r := mock_repositories.NewMockRepository(mockCtrl)
+		fmt.Println(c.description)
+		c.expect(r)
+		fmt.Println("ok")
+	}
+}
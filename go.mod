@@ -6,12 +6,13 @@ require (
 	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible // indirect
 	github.com/gofrs/uuid v3.2.0+incompatible
-	github.com/golang/mock v1.4.4 // indirect
+	github.com/golang/mock v1.4.4
 	github.com/labstack/echo v3.3.10+incompatible
 	github.com/labstack/gommon v0.3.0
 	github.com/onsi/gomega v1.10.5
 	github.com/tealeg/xlsx v1.0.5
-	github.com/tidwall/gjson v1.6.8 // indirect
+	github.com/tidwall/gjson v1.6.8
+	golang.org/x/text v0.3.3
 	gorm.io/driver/postgres v1.0.6
 	gorm.io/gorm v1.20.11
 )
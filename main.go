@@ -4,8 +4,10 @@ import (
 	"MartellX/avito-tech-task/controllers"
 	"MartellX/avito-tech-task/repositories"
 	"MartellX/avito-tech-task/services"
+	"fmt"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
+	"github.com/labstack/gommon/log"
 	"os"
 )
 
@@ -13,13 +15,23 @@ func main() {
 
 	r, err := repositories.NewRepositoryFromEnvironments()
 	if err != nil {
-		panic("Failed to connect to database")
+		panic(fmt.Sprintf("Failed to prepare database: %v", err))
 	}
 	if r == nil {
 		panic("one of env variables not set")
 	}
-	s := services.NewService(r)
+	cfg := services.ConfigFromEnvironments()
+	s := services.NewServiceWithConfig(r, cfg)
+	if n, err := s.InterruptUnfinishedTasks(); err != nil {
+		log.Error(err)
+	} else if n > 0 {
+		log.Warnf("%d unfinished tasks marked as interrupted", n)
+	}
+	scheduler := services.NewScheduler(r, s, cfg.SchedulePollInterval)
+	scheduler.Start()
 	handler := controllers.NewHandler(s, r)
+	handler.ScheduleService = scheduler
+	handler.MaxFileSize = int64(cfg.MaxFileSize)
 	e := echo.New()
 
 	e.Use(middleware.Logger())
@@ -27,7 +39,21 @@ func main() {
 
 	e.POST("/tasks", handler.NewTask)
 	e.GET("/tasks", handler.GetTask)
+	e.DELETE("/tasks", handler.CancelTask)
+	e.GET("/tasks/:id/errors", handler.GetTaskErrors)
+	e.GET("/tasks/:id/events", handler.TaskEvents)
+	e.POST("/schedules", handler.NewSchedule)
+	e.GET("/schedules", handler.GetSchedules)
+	e.POST("/schedules/:id/pause", handler.PauseSchedule)
+	e.POST("/schedules/:id/resume", handler.ResumeSchedule)
+	e.DELETE("/schedules/:id", handler.DeleteSchedule)
+	e.GET("/schedules/:id/tasks", handler.GetScheduleTasks)
 	e.GET("/offers", handler.GetOffers)
+	e.POST("/sellers/:seller_id/offers", handler.NewOffer)
+	e.GET("/sellers/:seller_id/offers/:offer_id", handler.GetOffer)
+	e.PUT("/sellers/:seller_id/offers/:offer_id", handler.ReplaceOffer)
+	e.PATCH("/sellers/:seller_id/offers/:offer_id", handler.PatchOffer)
+	e.DELETE("/sellers/:seller_id/offers/:offer_id", handler.DeleteOffer)
 	port, ok := os.LookupEnv("port")
 	if !ok {
 		port = "1323"
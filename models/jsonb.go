@@ -0,0 +1,26 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonbValue сохраняет v в jsonb-колонку
+func jsonbValue(v interface{}) (driver.Value, error) {
+	return json.Marshal(v)
+}
+
+// scanJsonb читает значение jsonb-колонки src в dest. NULL оставляет dest без изменений
+func scanJsonb(src interface{}, dest interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("unsupported type %T for %T", src, dest)
+	}
+}
@@ -5,12 +5,12 @@ import (
 )
 
 type Offer struct {
-	OfferId   uint64    `gorm:"primaryKey;autoIncrement:false;index:idx_offer" json:"offer_id"`
-	SellerId  uint64    `gorm:"primaryKey;autoIncrement:false;index:idx_offer" json:"seller_id"`
+	OfferId   uint64    `gorm:"primaryKey;autoIncrement:false;index:idx_offer;index:idx_offer_seller_offer,priority:2;index:idx_offer_price,priority:3;index:idx_offer_name,priority:3;index:idx_offer_updated_at,priority:3" json:"offer_id"`
+	SellerId  uint64    `gorm:"primaryKey;autoIncrement:false;index:idx_offer;index:idx_offer_seller_offer,priority:1;index:idx_offer_price,priority:2;index:idx_offer_name,priority:2;index:idx_offer_updated_at,priority:2" json:"seller_id"`
 	CreatedAt time.Time `json:"-"`
-	UpdatedAt time.Time `json:"-"`
-	Name      string    `json:"name"`
-	Price     int64     `json:"price"`
+	UpdatedAt time.Time `gorm:"index:idx_offer_updated_at,priority:1" json:"updated_at"`
+	Name      string    `gorm:"index:idx_offer_name,priority:1" json:"name"`
+	Price     int64     `gorm:"index:idx_offer_price,priority:1" json:"price"`
 	Quantity  int       `json:"quantity"`
 	Available bool      `json:"available"`
 }
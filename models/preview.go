@@ -0,0 +1,22 @@
+package models
+
+import (
+	"database/sql/driver"
+)
+
+// TaskPreview - результат пробного запуска: какие товары были бы созданы, обновлены и удалены
+type TaskPreview struct {
+	Created []Offer        `json:"created"`
+	Updated []Offer        `json:"updated"`
+	Deleted []Offer        `json:"deleted"`
+	Errors  []TaskRowError `json:"errors"`
+}
+
+// Value сохраняет результат в jsonb-колонку
+func (p TaskPreview) Value() (driver.Value, error) {
+	return jsonbValue(p)
+}
+
+func (p *TaskPreview) Scan(src interface{}) error {
+	return scanJsonb(src, p)
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Schedule - регулярный импорт таблицы продавца по ссылке по cron-выражению
+type Schedule struct {
+	Id       string `gorm:"primaryKey" json:"schedule_id"`
+	SellerId uint64 `gorm:"index:idx_schedule_seller" json:"seller_id"`
+	URL      string `json:"url"`
+	// Cron-выражение из пяти полей: минута, час, день месяца, месяц, день недели. Время в UTC
+	Cron   string `json:"cron"`
+	Paused bool   `json:"paused"`
+
+	// Когда расписание сработает в следующий раз, когда сработало в последний раз и какое задание создало.
+	// Если задание создать не удалось, в LastError причина
+	NextRunAt  *time.Time `gorm:"index:idx_schedule_next_run" json:"next_run_at,omitempty"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastTaskId string     `json:"last_task_id,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"-"`
+}
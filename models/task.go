@@ -0,0 +1,200 @@
+package models
+
+import (
+	"database/sql/driver"
+	"math"
+	"net/http"
+	"time"
+)
+
+const (
+	TaskStatusCreated     = "Created"
+	TaskStatusQueued      = "Queued"
+	TaskStatusDownloading = "Downloading"
+	TaskStatusParsing     = "Parsing"
+	TaskStatusCompleted   = "Completed"
+	TaskStatusInterrupted = "Interrupted"
+	TaskStatusCancelled   = "Cancelled"
+	TaskStatusRolledBack  = "RolledBack"
+	// Файл не изменился с прошлого импорта продавца, строки не обрабатывались
+	TaskStatusNoChanges = "NoChanges"
+)
+
+// Код для отмененных пользователем заданий, в net/http такого нет
+const StatusClientClosedRequest = 499
+
+// Коды статусов, при которых задание еще не завершено
+var UnfinishedTaskCodes = []int{http.StatusCreated, http.StatusAccepted, http.StatusProcessing}
+
+type TaskInfo struct {
+	Created int `json:"created,omitempty"`
+	Updated int `json:"updated,omitempty"`
+	Deleted int `json:"deleted,omitempty"`
+	Errors  int `json:"errors,omitempty"`
+	// Счетчики по листам книги, заполняются только при импорте всех листов.
+	// Товары, удаленные полной синхронизацией, не относятся ни к одному листу
+	Sheets SheetsInfo `gorm:"type:jsonb" json:"sheets,omitempty"`
+}
+
+type SheetInfo struct {
+	Name    string `json:"name"`
+	Created int    `json:"created,omitempty"`
+	Updated int    `json:"updated,omitempty"`
+	Deleted int    `json:"deleted,omitempty"`
+	Errors  int    `json:"errors,omitempty"`
+}
+
+type SheetsInfo []SheetInfo
+
+// Value сохраняет счетчики листов в jsonb-колонку
+func (s SheetsInfo) Value() (driver.Value, error) {
+	return jsonbValue(s)
+}
+
+func (s *SheetsInfo) Scan(src interface{}) error {
+	return scanJsonb(src, s)
+}
+
+// Sheet возвращает счетчики листа с именем name или nil, если листы не учитываются отдельно
+func (s SheetsInfo) Sheet(name string) *SheetInfo {
+	for i := range s {
+		if s[i].Name == name {
+			return &s[i]
+		}
+	}
+	return nil
+}
+
+// CallbackAttempt - попытка отправить завершенное задание на callback_url
+type CallbackAttempt struct {
+	At time.Time `json:"at"`
+	// Код ответа, 0 - если ответа не было
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type CallbackAttempts []CallbackAttempt
+
+// Value сохраняет попытки в jsonb-колонку
+func (a CallbackAttempts) Value() (driver.Value, error) {
+	return jsonbValue(a)
+}
+
+func (a *CallbackAttempts) Scan(src interface{}) error {
+	return scanJsonb(src, a)
+}
+
+type Task struct {
+	Id         string    `gorm:"primaryKey" json:"task_id"`
+	Status     string    `json:"status"`
+	StatusCode int       `gorm:"index:idx_task_status_code" json:"status_code"`
+	SellerId   uint64    `gorm:"index:idx_task_seller" json:"-"`
+	URL        string    `json:"-"`
+	FileName   string    `json:"file_name,omitempty"`
+	DryRun     bool      `json:"dry_run,omitempty"`
+	Atomic     bool      `json:"atomic,omitempty"`
+	Mode       string    `json:"mode,omitempty"`
+	Format     string    `json:"format,omitempty"`
+	CreatedAt  time.Time `json:"-"`
+	UpdatedAt  time.Time `json:"-"`
+
+	// Хеш содержимого файла вместе с параметрами разбора, по нему находится такой же прошлый импорт
+	ContentHash string `gorm:"index:idx_task_content_hash" json:"content_hash,omitempty"`
+	// Для статуса NoChanges - задание, которое уже импортировало этот файл
+	PreviousTaskId string `json:"previous_task_id,omitempty"`
+	// Строки, которые не удалось записать в базу. Такой импорт не считается уже выполненным для того же файла
+	DbFailures int `json:"-"`
+	// Товары продавца менялись через API после этого задания, поэтому тот же файл нужно применить заново
+	Stale          bool   `json:"-"`
+	IdempotencyKey string `gorm:"index:idx_task_idempotency_key" json:"-"`
+
+	// Адрес, на который отправляется завершенное задание, и попытки отправки
+	CallbackURL      string           `json:"callback_url,omitempty"`
+	CallbackAttempts CallbackAttempts `gorm:"type:jsonb" json:"callback_attempts,omitempty"`
+
+	// Расписание, по которому создано задание
+	ScheduleId string `gorm:"index:idx_task_schedule" json:"schedule_id,omitempty"`
+
+	// Ход выполнения: строк с товарами в таблице (известно после ее открытия) и сколько из них обработано,
+	// время, когда воркер взял задание и когда оно завершилось
+	TotalRows     int        `json:"total_rows,omitempty"`
+	ProcessedRows int        `json:"processed_rows,omitempty"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	// Процент обработанных строк, скорость в строках в секунду и оценка оставшегося времени в секундах.
+	// Не хранятся, вычисляются в ComputeProgress
+	Progress      float64 `gorm:"-" json:"progress,omitempty"`
+	RowsPerSecond float64 `gorm:"-" json:"rows_per_second,omitempty"`
+	EtaSeconds    int     `gorm:"-" json:"eta_seconds,omitempty"`
+
+	// Позиция в очереди, заполняется только для заданий в статусе Queued
+	QueuePosition int `gorm:"-" json:"queue_position,omitempty"`
+	// Задание уже было создано запросом с тем же ключом идемпотентности, заполняется только в ответе на повтор
+	Replayed bool `gorm:"-" json:"-"`
+
+	Info TaskInfo `gorm:"embedded;embeddedPrefix:info_" json:"info,omitempty"`
+	// Заполняется только для пробного запуска
+	Preview *TaskPreview `gorm:"type:jsonb" json:"preview,omitempty"`
+}
+
+func (t *Task) SetStatus(status string, code int) {
+	t.Status = status
+	t.StatusCode = code
+}
+
+// ComputeProgress заполняет процент выполнения, скорость обработки строк и, пока задание выполняется,
+// оценку оставшегося времени на момент now
+func (t *Task) ComputeProgress(now time.Time) {
+	t.Progress, t.RowsPerSecond, t.EtaSeconds = 0, 0, 0
+	if t.TotalRows > 0 {
+		t.Progress = math.Round(float64(t.ProcessedRows)*1000/float64(t.TotalRows)) / 10
+	}
+	if t.StartedAt == nil || t.ProcessedRows == 0 {
+		return
+	}
+	end := now
+	if t.FinishedAt != nil {
+		end = *t.FinishedAt
+	}
+	elapsed := end.Sub(*t.StartedAt).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	rate := float64(t.ProcessedRows) / elapsed
+	t.RowsPerSecond = math.Round(rate*10) / 10
+	if !t.IsFinished() && t.TotalRows > t.ProcessedRows {
+		t.EtaSeconds = int(math.Ceil(float64(t.TotalRows-t.ProcessedRows) / rate))
+	}
+}
+
+func (t *Task) IsFinished() bool {
+	for _, code := range UnfinishedTaskCodes {
+		if t.StatusCode == code {
+			return false
+		}
+	}
+	return true
+}
+
+// Причины, по которым строка таблицы не была обработана
+const (
+	RowErrorMissingCells     = "missing_cells"
+	RowErrorBadOfferId       = "bad_offer_id"
+	RowErrorBadPrice         = "bad_price"
+	RowErrorNegativePrice    = "negative_price"
+	RowErrorBadQuantity      = "bad_quantity"
+	RowErrorNegativeQuantity = "negative_quantity"
+	RowErrorBadAvailable     = "bad_available"
+	RowErrorDbFailure        = "db_failure"
+)
+
+type TaskRowError struct {
+	Id      uint64 `gorm:"primaryKey" json:"-"`
+	TaskId  string `gorm:"index:idx_task_row_error" json:"-"`
+	Sheet   string `json:"sheet,omitempty"`
+	Row     int    `gorm:"column:row_number" json:"row"`
+	Column  string `json:"column,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
@@ -9,6 +9,8 @@ import (
 	"gorm.io/gorm/logger"
 	"log"
 	"os"
+	"strings"
+	"time"
 )
 
 type PostgresRepository struct {
@@ -39,7 +41,11 @@ func NewRepositoryFromEnvironments() (*PostgresRepository, error) {
 
 	fmt.Println("Connected to database")
 	db := conn
-	db.AutoMigrate(&models.Offer{})
+	db.AutoMigrate(&models.Offer{}, &models.Task{}, &models.TaskRowError{}, &models.Schedule{})
+	// Без колонки search каждый запрос с q завершался бы ошибкой, поэтому сервис не запускается
+	if err := MigrateOfferSearch(db); err != nil {
+		return nil, fmt.Errorf("offer search migration failed: %w", err)
+	}
 
 	return &PostgresRepository{db: db}, nil
 }
@@ -52,6 +58,14 @@ func (r *PostgresRepository) SetDB(gdb *gorm.DB) {
 	r.db = gdb
 }
 
+// Transaction выполняет fn с репозиторием, работающим в одной транзакции.
+// Если fn вернула ошибку, транзакция откатывается
+func (r *PostgresRepository) Transaction(fn func(repo Repository) error) error {
+	return r.GetDB().Transaction(func(tx *gorm.DB) error {
+		return fn(NewRepository(tx))
+	})
+}
+
 func (r *PostgresRepository) NewOffer(offerId uint64, sellerId uint64, name string, price int64, quantity int, available bool) (*models.Offer, error) {
 	offer := &models.Offer{OfferId: offerId, SellerId: sellerId, Name: name, Price: price, Quantity: quantity, Available: available}
 	res := r.GetDB().Session(&gorm.Session{Logger: silentLogger}).Create(offer)
@@ -76,8 +90,9 @@ func (r *PostgresRepository) UpdateColumns(o *models.Offer, name string, price i
 	return r.Update(o)
 }
 
-func (r *PostgresRepository) Delete(o *models.Offer) {
-	r.GetDB().Delete(o)
+func (r *PostgresRepository) Delete(o *models.Offer) error {
+	res := r.GetDB().Delete(o)
+	return res.Error
 }
 
 var silentLogger = logger.New(
@@ -87,51 +102,80 @@ var silentLogger = logger.New(
 	},
 )
 
-//
-//type OfferParams struct {
-//	OfferId *uint
-//	SellerId *uint
-//	Name *string
-//}
+// offerConditions добавляет к запросу условия поиска товаров
+func offerConditions(condition *gorm.DB, q OfferQuery) *gorm.DB {
+	if q.OfferId != nil {
+		condition = condition.Where("offer_id = ?", *q.OfferId)
+	}
+	if q.SellerId != nil {
+		condition = condition.Where("seller_id = ?", *q.SellerId)
+	}
+	if q.Name != "" {
+		condition = condition.Where("name ILIKE ?", "%"+q.Name+"%")
+	}
+	if q.Search != "" {
+		condition = offerSearchCondition(condition, q.Search)
+	}
+	if q.PriceMin != nil {
+		condition = condition.Where("price >= ?", *q.PriceMin)
+	}
+	if q.PriceMax != nil {
+		condition = condition.Where("price <= ?", *q.PriceMax)
+	}
+	if q.QuantityMin != nil {
+		condition = condition.Where("quantity >= ?", *q.QuantityMin)
+	}
+	if q.Available != nil {
+		condition = condition.Where("available = ?", *q.Available)
+	}
+	if q.UpdatedSince != nil {
+		condition = condition.Where("updated_at >= ?", *q.UpdatedSince)
+	}
+	return condition
+}
 
-func (r *PostgresRepository) FindOffersByConditions(args map[string]interface{}) ([]models.Offer, error) {
+// FindOffers возвращает страницу товаров, подходящих под условия поиска.
+// Если условия не согласованы, возвращается ошибка с ErrInvalidOfferQuery
+func (r *PostgresRepository) FindOffers(q OfferQuery) ([]models.Offer, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
 
 	tx := r.GetDB().Session(&gorm.Session{Logger: silentLogger})
 	var offers []models.Offer
-	//conditions := make([]string, 0, 3)
-	//conditionArgs := make([]interface{}, 0, 3)
-	condition := tx.Model(&offers)
-	if offerId, ok := args["offer_id"]; ok {
-
-		// Если неправильного типа, то просто не добавляем в запрос, другое решение - возвращать ошибку
-		switch offerId.(type) {
-		case uint, uint64, uint32:
-			//conditions = append(conditions, "offer_id = ?")
-			//conditionArgs = append(conditionArgs, offerId)
-			condition = condition.Where("offer_id = ?", offerId)
-		}
+	condition := offerConditions(tx.Model(&offers), q)
 
+	// Ключ товара дополняет поле сортировки, чтобы порядок был однозначным и по нему можно было продолжить
+	columns := []string{"seller_id", "offer_id"}
+	var after []interface{}
+	if q.After != nil {
+		after = []interface{}{q.After.SellerId, q.After.OfferId}
 	}
-	if sellerId, ok := args["seller_id"]; ok {
-		switch sellerId.(type) {
-		case uint, uint64, uint32:
-			//conditions = append(conditions, "seller_id = ?")
-			//conditionArgs = append(conditionArgs, sellerId)
-			condition = condition.Where("seller_id = ?", sellerId)
+	if field := strings.TrimPrefix(q.Sort, "-"); field != "" {
+		columns = append([]string{field}, columns...)
+		if q.After != nil {
+			value, _ := offerSortValue(q.After, field)
+			after = append([]interface{}{value}, after...)
 		}
-
 	}
-	if name, ok := args["name"]; ok {
-		switch name.(type) {
-		case string:
-			//conditions = append(conditions, "name ~ ?")
-			//conditionArgs = append(conditionArgs, name)
-			condition = condition.Where("name ILIKE ?", "%"+name.(string)+"%")
-		}
-
+	direction, compare := "", ">"
+	if strings.HasPrefix(q.Sort, "-") {
+		direction, compare = " DESC", "<"
 	}
 
-	//result := GetDB().Find(&offers, strings.Join(conditions, "AND"), conditionArgs)
+	if q.After != nil {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(after)), ", ")
+		condition = condition.Where(fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), compare, placeholders), after...)
+	}
+	if q.ByRelevance() {
+		condition = offerRelevanceOrder(condition, q.Search)
+	} else {
+		condition = condition.Order(strings.Join(columns, direction+", ") + direction)
+	}
+	condition = condition.Offset(q.Offset)
+	if q.Limit > 0 {
+		condition = condition.Limit(q.Limit)
+	}
 
 	result := condition.Find(&offers)
 
@@ -141,6 +185,20 @@ func (r *PostgresRepository) FindOffersByConditions(args map[string]interface{})
 	return offers, nil
 }
 
+// CountOffers возвращает количество товаров, подходящих под условия поиска. Сортировка и страница не учитываются
+func (r *PostgresRepository) CountOffers(q OfferQuery) (int64, error) {
+	if err := q.Validate(); err != nil {
+		return 0, err
+	}
+	tx := r.GetDB().Session(&gorm.Session{Logger: silentLogger})
+
+	var total int64
+	if res := offerConditions(tx.Model(&models.Offer{}), q).Count(&total); res.Error != nil {
+		return 0, errors.New("database exception")
+	}
+	return total, nil
+}
+
 func (r *PostgresRepository) FindOffer(offerId, sellerId uint64) (*models.Offer, error) {
 
 	tx := r.GetDB().Session(&gorm.Session{Logger: silentLogger})
@@ -152,3 +210,66 @@ func (r *PostgresRepository) FindOffer(offerId, sellerId uint64) (*models.Offer,
 	}
 	return &offer, nil
 }
+
+// UpsertOffers вставляет товары продавца одним запросом, а уже существующие обновляет.
+// Возвращает, сколько товаров было создано и сколько обновлено
+// MaxUpsertBatchSize - сколько товаров можно записать одним UpsertOffers: на товар приходится 8 параметров,
+// а PostgreSQL принимает в запросе не больше 65535
+const MaxUpsertBatchSize = 65535 / 8
+
+func (r *PostgresRepository) UpsertOffers(sellerId uint64, offers []models.Offer) (created, updated int, err error) {
+	if len(offers) == 0 {
+		return 0, 0, nil
+	}
+
+	now := time.Now()
+	values := make([]string, 0, len(offers))
+	args := make([]interface{}, 0, len(offers)*8)
+	for _, o := range offers {
+		values = append(values, "(?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, o.OfferId, sellerId, now, now, o.Name, o.Price, o.Quantity, o.Available)
+	}
+
+	// xmax = 0 только у только что вставленных строк, так отличаем создание от обновления
+	query := "INSERT INTO offers (offer_id, seller_id, created_at, updated_at, name, price, quantity, available) VALUES " +
+		strings.Join(values, ", ") +
+		" ON CONFLICT (offer_id, seller_id) DO UPDATE SET updated_at = EXCLUDED.updated_at, name = EXCLUDED.name," +
+		" price = EXCLUDED.price, quantity = EXCLUDED.quantity, available = EXCLUDED.available" +
+		" RETURNING (xmax = 0) AS inserted"
+
+	rows, err := r.GetDB().Session(&gorm.Session{Logger: silentLogger}).Raw(query, args...).Rows()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var inserted bool
+		if err := rows.Scan(&inserted); err != nil {
+			return 0, 0, err
+		}
+		if inserted {
+			created++
+		} else {
+			updated++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	return created, updated, nil
+}
+
+// DeleteOffers удаляет товары продавца по offer_id и возвращает количество удаленных
+func (r *PostgresRepository) DeleteOffers(sellerId uint64, offerIds []uint64) (int64, error) {
+	if len(offerIds) == 0 {
+		return 0, nil
+	}
+	res := r.GetDB().Session(&gorm.Session{Logger: silentLogger}).
+		Where("seller_id = ? AND offer_id IN ?", sellerId, offerIds).
+		Delete(&models.Offer{})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return res.RowsAffected, nil
+}
@@ -2,7 +2,9 @@ package mock_repositories
 
 import (
 	models "MartellX/avito-tech-task/models"
+	repositories "MartellX/avito-tech-task/repositories"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	gorm "gorm.io/gorm"
@@ -31,10 +33,69 @@ func (m *MockRepository) EXPECT() *MockRepositoryMockRecorder {
 	return m.recorder
 }
 
+// CountOffers mock_services base method.
+func (m *MockRepository) CountOffers(arg0 repositories.OfferQuery) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountOffers", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountOffers indicates an expected call of CountOffers.
+func (mr *MockRepositoryMockRecorder) CountOffers(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountOffers", reflect.TypeOf((*MockRepository)(nil).CountOffers), arg0)
+}
+
+// CreateSchedule mock_services base method.
+func (m *MockRepository) CreateSchedule(arg0 *models.Schedule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSchedule", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSchedule indicates an expected call of CreateSchedule.
+func (mr *MockRepositoryMockRecorder) CreateSchedule(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSchedule", reflect.TypeOf((*MockRepository)(nil).CreateSchedule), arg0)
+}
+
+// CreateTask mock_services base method.
+func (m *MockRepository) CreateTask(arg0 *models.Task) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTask", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateTask indicates an expected call of CreateTask.
+func (mr *MockRepositoryMockRecorder) CreateTask(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTask", reflect.TypeOf((*MockRepository)(nil).CreateTask), arg0)
+}
+
+// CreateTaskRowErrors mock_services base method.
+func (m *MockRepository) CreateTaskRowErrors(arg0 []models.TaskRowError) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTaskRowErrors", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateTaskRowErrors indicates an expected call of CreateTaskRowErrors.
+func (mr *MockRepositoryMockRecorder) CreateTaskRowErrors(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTaskRowErrors", reflect.TypeOf((*MockRepository)(nil).CreateTaskRowErrors), arg0)
+}
+
 // Delete mock_services base method.
-func (m *MockRepository) Delete(arg0 *models.Offer) {
+func (m *MockRepository) Delete(arg0 *models.Offer) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Delete", arg0)
+	ret := m.ctrl.Call(m, "Delete", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // Delete indicates an expected call of Delete.
@@ -43,6 +104,66 @@ func (mr *MockRepositoryMockRecorder) Delete(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockRepository)(nil).Delete), arg0)
 }
 
+// DeleteOffers mock_services base method.
+func (m *MockRepository) DeleteOffers(arg0 uint64, arg1 []uint64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteOffers", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteOffers indicates an expected call of DeleteOffers.
+func (mr *MockRepositoryMockRecorder) DeleteOffers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOffers", reflect.TypeOf((*MockRepository)(nil).DeleteOffers), arg0, arg1)
+}
+
+// DeleteSchedule mock_services base method.
+func (m *MockRepository) DeleteSchedule(arg0 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSchedule", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteSchedule indicates an expected call of DeleteSchedule.
+func (mr *MockRepositoryMockRecorder) DeleteSchedule(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSchedule", reflect.TypeOf((*MockRepository)(nil).DeleteSchedule), arg0)
+}
+
+// FindDueSchedules mock_services base method.
+func (m *MockRepository) FindDueSchedules(arg0 time.Time) ([]models.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDueSchedules", arg0)
+	ret0, _ := ret[0].([]models.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDueSchedules indicates an expected call of FindDueSchedules.
+func (mr *MockRepositoryMockRecorder) FindDueSchedules(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDueSchedules", reflect.TypeOf((*MockRepository)(nil).FindDueSchedules), arg0)
+}
+
+// FindLastImportTask mock_services base method.
+func (m *MockRepository) FindLastImportTask(arg0 uint64, arg1 string) (*models.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindLastImportTask", arg0, arg1)
+	ret0, _ := ret[0].(*models.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindLastImportTask indicates an expected call of FindLastImportTask.
+func (mr *MockRepositoryMockRecorder) FindLastImportTask(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindLastImportTask", reflect.TypeOf((*MockRepository)(nil).FindLastImportTask), arg0, arg1)
+}
+
 // FindOffer mock_services base method.
 func (m *MockRepository) FindOffer(arg0, arg1 uint64) (*models.Offer, error) {
 	m.ctrl.T.Helper()
@@ -58,19 +179,111 @@ func (mr *MockRepositoryMockRecorder) FindOffer(arg0, arg1 interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOffer", reflect.TypeOf((*MockRepository)(nil).FindOffer), arg0, arg1)
 }
 
-// FindOffersByConditions mock_services base method.
-func (m *MockRepository) FindOffersByConditions(arg0 map[string]interface{}) ([]models.Offer, error) {
+// FindOffers mock_services base method.
+func (m *MockRepository) FindOffers(arg0 repositories.OfferQuery) ([]models.Offer, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindOffersByConditions", arg0)
+	ret := m.ctrl.Call(m, "FindOffers", arg0)
 	ret0, _ := ret[0].([]models.Offer)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// FindOffersByConditions indicates an expected call of FindOffersByConditions.
-func (mr *MockRepositoryMockRecorder) FindOffersByConditions(arg0 interface{}) *gomock.Call {
+// FindOffers indicates an expected call of FindOffers.
+func (mr *MockRepositoryMockRecorder) FindOffers(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOffers", reflect.TypeOf((*MockRepository)(nil).FindOffers), arg0)
+}
+
+// FindSchedule mock_services base method.
+func (m *MockRepository) FindSchedule(arg0 string) (*models.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindSchedule", arg0)
+	ret0, _ := ret[0].(*models.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindSchedule indicates an expected call of FindSchedule.
+func (mr *MockRepositoryMockRecorder) FindSchedule(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindSchedule", reflect.TypeOf((*MockRepository)(nil).FindSchedule), arg0)
+}
+
+// FindScheduleTasks mock_services base method.
+func (m *MockRepository) FindScheduleTasks(arg0 string, arg1, arg2 int) ([]models.Task, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindScheduleTasks", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]models.Task)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// FindScheduleTasks indicates an expected call of FindScheduleTasks.
+func (mr *MockRepositoryMockRecorder) FindScheduleTasks(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindScheduleTasks", reflect.TypeOf((*MockRepository)(nil).FindScheduleTasks), arg0, arg1, arg2)
+}
+
+// FindSchedules mock_services base method.
+func (m *MockRepository) FindSchedules(arg0 uint64) ([]models.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindSchedules", arg0)
+	ret0, _ := ret[0].([]models.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindSchedules indicates an expected call of FindSchedules.
+func (mr *MockRepositoryMockRecorder) FindSchedules(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOffersByConditions", reflect.TypeOf((*MockRepository)(nil).FindOffersByConditions), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindSchedules", reflect.TypeOf((*MockRepository)(nil).FindSchedules), arg0)
+}
+
+// FindTask mock_services base method.
+func (m *MockRepository) FindTask(arg0 string) (*models.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindTask", arg0)
+	ret0, _ := ret[0].(*models.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindTask indicates an expected call of FindTask.
+func (mr *MockRepositoryMockRecorder) FindTask(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindTask", reflect.TypeOf((*MockRepository)(nil).FindTask), arg0)
+}
+
+// FindTaskByIdempotencyKey mock_services base method.
+func (m *MockRepository) FindTaskByIdempotencyKey(arg0 uint64, arg1 string) (*models.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindTaskByIdempotencyKey", arg0, arg1)
+	ret0, _ := ret[0].(*models.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindTaskByIdempotencyKey indicates an expected call of FindTaskByIdempotencyKey.
+func (mr *MockRepositoryMockRecorder) FindTaskByIdempotencyKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindTaskByIdempotencyKey", reflect.TypeOf((*MockRepository)(nil).FindTaskByIdempotencyKey), arg0, arg1)
+}
+
+// FindTaskRowErrors mock_services base method.
+func (m *MockRepository) FindTaskRowErrors(arg0 string, arg1, arg2 int) ([]models.TaskRowError, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindTaskRowErrors", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]models.TaskRowError)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// FindTaskRowErrors indicates an expected call of FindTaskRowErrors.
+func (mr *MockRepositoryMockRecorder) FindTaskRowErrors(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindTaskRowErrors", reflect.TypeOf((*MockRepository)(nil).FindTaskRowErrors), arg0, arg1, arg2)
 }
 
 // GetDB mock_services base method.
@@ -87,6 +300,20 @@ func (mr *MockRepositoryMockRecorder) GetDB() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDB", reflect.TypeOf((*MockRepository)(nil).GetDB))
 }
 
+// MarkImportsStale mock_services base method.
+func (m *MockRepository) MarkImportsStale(arg0 uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkImportsStale", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkImportsStale indicates an expected call of MarkImportsStale.
+func (mr *MockRepositoryMockRecorder) MarkImportsStale(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkImportsStale", reflect.TypeOf((*MockRepository)(nil).MarkImportsStale), arg0)
+}
+
 // NewOffer mock_services base method.
 func (m *MockRepository) NewOffer(arg0, arg1 uint64, arg2 string, arg3 int64, arg4 int, arg5 bool) (*models.Offer, error) {
 	m.ctrl.T.Helper()
@@ -102,6 +329,34 @@ func (mr *MockRepositoryMockRecorder) NewOffer(arg0, arg1, arg2, arg3, arg4, arg
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewOffer", reflect.TypeOf((*MockRepository)(nil).NewOffer), arg0, arg1, arg2, arg3, arg4, arg5)
 }
 
+// SaveSchedule mock_services base method.
+func (m *MockRepository) SaveSchedule(arg0 *models.Schedule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSchedule", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveSchedule indicates an expected call of SaveSchedule.
+func (mr *MockRepositoryMockRecorder) SaveSchedule(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSchedule", reflect.TypeOf((*MockRepository)(nil).SaveSchedule), arg0)
+}
+
+// SaveTask mock_services base method.
+func (m *MockRepository) SaveTask(arg0 *models.Task) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveTask", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveTask indicates an expected call of SaveTask.
+func (mr *MockRepositoryMockRecorder) SaveTask(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveTask", reflect.TypeOf((*MockRepository)(nil).SaveTask), arg0)
+}
+
 // SetDB mock_services base method.
 func (m *MockRepository) SetDB(arg0 *gorm.DB) {
 	m.ctrl.T.Helper()
@@ -114,6 +369,20 @@ func (mr *MockRepositoryMockRecorder) SetDB(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDB", reflect.TypeOf((*MockRepository)(nil).SetDB), arg0)
 }
 
+// Transaction mock_services base method.
+func (m *MockRepository) Transaction(arg0 func(repositories.Repository) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Transaction", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Transaction indicates an expected call of Transaction.
+func (mr *MockRepositoryMockRecorder) Transaction(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Transaction", reflect.TypeOf((*MockRepository)(nil).Transaction), arg0)
+}
+
 // Update mock_services base method.
 func (m *MockRepository) Update(arg0 *models.Offer) error {
 	m.ctrl.T.Helper()
@@ -141,3 +410,34 @@ func (mr *MockRepositoryMockRecorder) UpdateColumns(arg0, arg1, arg2, arg3, arg4
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateColumns", reflect.TypeOf((*MockRepository)(nil).UpdateColumns), arg0, arg1, arg2, arg3, arg4)
 }
+
+// UpdateTasksStatus mock_services base method.
+func (m *MockRepository) UpdateTasksStatus(arg0 []int, arg1 string, arg2 int) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateTasksStatus", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateTasksStatus indicates an expected call of UpdateTasksStatus.
+func (mr *MockRepositoryMockRecorder) UpdateTasksStatus(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTasksStatus", reflect.TypeOf((*MockRepository)(nil).UpdateTasksStatus), arg0, arg1, arg2)
+}
+
+// UpsertOffers mock_services base method.
+func (m *MockRepository) UpsertOffers(arg0 uint64, arg1 []models.Offer) (int, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpsertOffers", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// UpsertOffers indicates an expected call of UpsertOffers.
+func (mr *MockRepositoryMockRecorder) UpsertOffers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertOffers", reflect.TypeOf((*MockRepository)(nil).UpsertOffers), arg0, arg1)
+}
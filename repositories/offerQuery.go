@@ -0,0 +1,95 @@
+package repositories
+
+import (
+	"MartellX/avito-tech-task/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidOfferQuery = errors.New("invalid offer query")
+
+// Поля, по которым можно сортировать товары. С минусом перед названием - по убыванию
+const (
+	OfferSortPrice     = "price"
+	OfferSortName      = "name"
+	OfferSortUpdatedAt = "updated_at"
+)
+
+// OfferQuery - поиск товаров. Незаданные (nil или пустые) условия не ограничивают выборку.
+// Товары упорядочены по полю Sort, а при равных значениях - по seller_id, offer_id
+type OfferQuery struct {
+	OfferId  *uint64
+	SellerId *uint64
+	// Подстрока названия без учета регистра
+	Name string
+	// Полнотекстовый поиск по словам названия, с учетом опечаток
+	Search string
+	// Границы включительно
+	PriceMin     *int64
+	PriceMax     *int64
+	QuantityMin  *int
+	Available    *bool
+	UpdatedSince *time.Time
+
+	// Пустое - по релевантности, если задан Search, иначе только по seller_id, offer_id
+	Sort string
+	// Страница: 0 в Limit - без ограничения
+	Limit  int
+	Offset int
+	// Страница начинается после этого товара в порядке сортировки. Быстрее смещения на далеких страницах,
+	// вместе со смещением не используется
+	After *models.Offer
+}
+
+// Validate проверяет, что условия поиска согласованы. Ошибка оборачивает ErrInvalidOfferQuery
+// и называет неверный параметр так же, как он называется в запросе к API
+func (q OfferQuery) Validate() error {
+	switch {
+	case q.PriceMin != nil && *q.PriceMin < 0:
+		return fmt.Errorf("%w: price_min is negative", ErrInvalidOfferQuery)
+	case q.PriceMax != nil && *q.PriceMax < 0:
+		return fmt.Errorf("%w: price_max is negative", ErrInvalidOfferQuery)
+	case q.PriceMin != nil && q.PriceMax != nil && *q.PriceMin > *q.PriceMax:
+		return fmt.Errorf("%w: price_min is greater than price_max", ErrInvalidOfferQuery)
+	case q.QuantityMin != nil && *q.QuantityMin < 0:
+		return fmt.Errorf("%w: quantity_min is negative", ErrInvalidOfferQuery)
+	case q.Limit < 0:
+		return fmt.Errorf("%w: limit is negative", ErrInvalidOfferQuery)
+	case q.Offset < 0:
+		return fmt.Errorf("%w: offset is negative", ErrInvalidOfferQuery)
+	case q.After != nil && q.Offset > 0:
+		return fmt.Errorf("%w: offset cannot be combined with cursor", ErrInvalidOfferQuery)
+	case q.Search != "" && len(offerSearchTerms(q.Search)) == 0:
+		return fmt.Errorf("%w: q has no words to search", ErrInvalidOfferQuery)
+	case q.After != nil && q.ByRelevance():
+		return fmt.Errorf("%w: cursor cannot be used with relevance order, use offset or sort", ErrInvalidOfferQuery)
+	}
+	if q.Sort != "" {
+		if _, ok := offerSortValue(&models.Offer{}, strings.TrimPrefix(q.Sort, "-")); !ok {
+			return fmt.Errorf("%w: unknown sort %q, expected %s, %s or %s", ErrInvalidOfferQuery, q.Sort,
+				OfferSortPrice, OfferSortName, OfferSortUpdatedAt)
+		}
+	}
+	return nil
+}
+
+// ByRelevance сообщает, упорядочены ли товары по релевантности поиска.
+// Такой порядок нельзя продолжить по курсору, только по смещению
+func (q OfferQuery) ByRelevance() bool {
+	return q.Search != "" && q.Sort == ""
+}
+
+// offerSortValue возвращает значение поля сортировки товара. Другие поля для сортировки не допускаются
+func offerSortValue(o *models.Offer, field string) (interface{}, bool) {
+	switch field {
+	case OfferSortPrice:
+		return o.Price, true
+	case OfferSortName:
+		return o.Name, true
+	case OfferSortUpdatedAt:
+		return o.UpdatedAt, true
+	}
+	return nil, false
+}
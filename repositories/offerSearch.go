@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"unicode"
+)
+
+// Полнотекстовый поиск по названию товара. Колонка search вычисляется базой из названия
+// на русском и английском, поэтому в модели Offer ее нет и AutoMigrate ее не создает.
+// Триграммный индекс по названию нужен для поиска с опечатками
+var offerSearchMigrations = []string{
+	"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+	`ALTER TABLE offers ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS
+		(to_tsvector('russian', coalesce(name, '')) || to_tsvector('english', coalesce(name, ''))) STORED`,
+	"CREATE INDEX IF NOT EXISTS idx_offer_search ON offers USING GIN (search)",
+	"CREATE INDEX IF NOT EXISTS idx_offer_name_trgm ON offers USING GIN (name gin_trgm_ops)",
+}
+
+// MigrateOfferSearch создает колонку и индексы для полнотекстового поиска товаров. Требуется PostgreSQL 12+
+func MigrateOfferSearch(db *gorm.DB) error {
+	for _, migration := range offerSearchMigrations {
+		if res := db.Exec(migration); res.Error != nil {
+			return res.Error
+		}
+	}
+	return nil
+}
+
+// Запрос для обеих конфигураций, в которых построена колонка search
+const offerTsQuery = "(to_tsquery('russian', ?) || to_tsquery('english', ?))"
+
+// offerSearchTerms разбивает строку поиска на слова. Остальные символы отбрасываются,
+// чтобы пользователь не мог передать операторы to_tsquery
+func offerSearchTerms(search string) []string {
+	return strings.FieldsFunc(search, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// offerTsQueryText строит запрос to_tsquery, в котором должны встретиться все слова.
+// Каждое слово ищется как префикс, чтобы находить товары по началу слова
+func offerTsQueryText(search string) string {
+	terms := offerSearchTerms(search)
+	for i := range terms {
+		terms[i] += ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+// offerSearchCondition добавляет условие поиска: совпадение по словам или, если в словах опечатка,
+// похожесть названия по триграммам (порог - pg_trgm.word_similarity_threshold)
+func offerSearchCondition(condition *gorm.DB, search string) *gorm.DB {
+	tsQuery := offerTsQueryText(search)
+	// Условие с OR gorm сам берет в скобки, если есть другие условия
+	return condition.Where("search @@ "+offerTsQuery+" OR ? <% name", tsQuery, tsQuery, search)
+}
+
+// offerRelevanceOrder упорядочивает товары по релевантности: сначала совпавшие по словам по рангу,
+// затем найденные по триграммам по похожести названия
+func offerRelevanceOrder(condition *gorm.DB, search string) *gorm.DB {
+	tsQuery := offerTsQueryText(search)
+	return condition.Clauses(clause.OrderBy{Expression: clause.Expr{
+		SQL:  "ts_rank(search, " + offerTsQuery + ") DESC, word_similarity(?, name) DESC, seller_id, offer_id",
+		Vars: []interface{}{tsQuery, tsQuery, search},
+	}})
+}
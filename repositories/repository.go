@@ -3,15 +3,38 @@ package repositories
 import (
 	"MartellX/avito-tech-task/models"
 	"gorm.io/gorm"
+	"time"
 )
 
 type Repository interface {
 	GetDB() *gorm.DB
 	SetDB(gdb *gorm.DB)
+	Transaction(fn func(repo Repository) error) error
 	NewOffer(offerId uint64, sellerId uint64, name string, price int64, quantity int, available bool) (*models.Offer, error)
 	Update(o *models.Offer) error
 	UpdateColumns(o *models.Offer, name string, price int64, quantity int, available bool) error
-	Delete(o *models.Offer)
-	FindOffersByConditions(args map[string]interface{}) ([]models.Offer, error)
+	Delete(o *models.Offer) error
+	FindOffers(q OfferQuery) ([]models.Offer, error)
+	CountOffers(q OfferQuery) (int64, error)
 	FindOffer(offerId, sellerId uint64) (*models.Offer, error)
+	UpsertOffers(sellerId uint64, offers []models.Offer) (created, updated int, err error)
+	DeleteOffers(sellerId uint64, offerIds []uint64) (int64, error)
+
+	CreateTask(t *models.Task) error
+	SaveTask(t *models.Task) error
+	FindTask(id string) (*models.Task, error)
+	FindLastImportTask(sellerId uint64, excludeId string) (*models.Task, error)
+	MarkImportsStale(sellerId uint64) error
+	FindTaskByIdempotencyKey(sellerId uint64, key string) (*models.Task, error)
+	UpdateTasksStatus(fromCodes []int, status string, code int) (int64, error)
+	CreateTaskRowErrors(errs []models.TaskRowError) error
+	FindTaskRowErrors(taskId string, limit, offset int) ([]models.TaskRowError, int64, error)
+
+	CreateSchedule(s *models.Schedule) error
+	SaveSchedule(s *models.Schedule) error
+	FindSchedule(id string) (*models.Schedule, error)
+	FindSchedules(sellerId uint64) ([]models.Schedule, error)
+	FindDueSchedules(now time.Time) ([]models.Schedule, error)
+	DeleteSchedule(id string) (int64, error)
+	FindScheduleTasks(scheduleId string, limit, offset int) ([]models.Task, int64, error)
 }
@@ -5,6 +5,8 @@ import (
 	"MartellX/avito-tech-task/repositories"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
+	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
 	. "github.com/onsi/gomega"
 	"gorm.io/driver/postgres"
@@ -176,7 +178,7 @@ func TestFindOffer(t *testing.T) {
 	g.Expect(err).ShouldNot(HaveOccurred())
 }
 
-func TestFindOffersByConditions(t *testing.T) {
+func TestFindOffers(t *testing.T) {
 	// Before
 	g := NewGomegaWithT(t)
 	mock, repo, err := SetNewMock()
@@ -234,6 +236,8 @@ func TestFindOffersByConditions(t *testing.T) {
 		},
 	}
 
+	var offerId, sellerId uint64
+
 	// When seller_id is provided only him offers should return
 
 	// seller_id = 1
@@ -246,10 +250,8 @@ func TestFindOffersByConditions(t *testing.T) {
 		WithArgs(1).
 		WillReturnRows(rows)
 
-	args := map[string]interface{}{
-		"seller_id": uint(1),
-	}
-	offers, err := repo.FindOffersByConditions(args)
+	sellerId = 1
+	offers, err := repo.FindOffers(repositories.OfferQuery{SellerId: &sellerId})
 	g.Expect(err).ShouldNot(HaveOccurred())
 	g.Expect(offers).Should(And(HaveLen(3), ContainElements(testOffers[:3])))
 
@@ -265,10 +267,8 @@ func TestFindOffersByConditions(t *testing.T) {
 		WithArgs(3).
 		WillReturnRows(rows)
 
-	args = map[string]interface{}{
-		"offer_id": uint(3),
-	}
-	offers, err = repo.FindOffersByConditions(args)
+	offerId = 3
+	offers, err = repo.FindOffers(repositories.OfferQuery{OfferId: &offerId})
 	g.Expect(err).ShouldNot(HaveOccurred())
 	g.Expect(offers).Should(And(HaveLen(2), ContainElements(testOffers[3:5])))
 
@@ -285,10 +285,7 @@ func TestFindOffersByConditions(t *testing.T) {
 		WithArgs("%iPhone%").
 		WillReturnRows(rows)
 
-	args = map[string]interface{}{
-		"name": "iPhone",
-	}
-	offers, err = repo.FindOffersByConditions(args)
+	offers, err = repo.FindOffers(repositories.OfferQuery{Name: "iPhone"})
 	g.Expect(err).ShouldNot(HaveOccurred())
 	g.Expect(offers).Should(And(HaveLen(2), ContainElements(append(testOffers[:1], testOffers[3]))))
 
@@ -305,11 +302,8 @@ func TestFindOffersByConditions(t *testing.T) {
 		WithArgs(3, 2).
 		WillReturnRows(rows)
 
-	args = map[string]interface{}{
-		"offer_id":  uint(3),
-		"seller_id": uint(2),
-	}
-	offers, err = repo.FindOffersByConditions(args)
+	offerId, sellerId = 3, 2
+	offers, err = repo.FindOffers(repositories.OfferQuery{OfferId: &offerId, SellerId: &sellerId})
 	g.Expect(err).ShouldNot(HaveOccurred())
 	g.Expect(offers).Should(And(HaveLen(1), ContainElements(testOffers[3:4])))
 
@@ -326,11 +320,8 @@ func TestFindOffersByConditions(t *testing.T) {
 		WithArgs(1, "%iPhone%").
 		WillReturnRows(rows)
 
-	args = map[string]interface{}{
-		"offer_id": uint(1),
-		"name":     "iPhone",
-	}
-	offers, err = repo.FindOffersByConditions(args)
+	offerId = 1
+	offers, err = repo.FindOffers(repositories.OfferQuery{OfferId: &offerId, Name: "iPhone"})
 	g.Expect(err).ShouldNot(HaveOccurred())
 	g.Expect(offers).Should(And(HaveLen(1), ContainElements(testOffers[:1])))
 
@@ -347,11 +338,8 @@ func TestFindOffersByConditions(t *testing.T) {
 		WithArgs(2, "%Guit%").
 		WillReturnRows(rows)
 
-	args = map[string]interface{}{
-		"seller_id": uint(2),
-		"name":      "Guit",
-	}
-	offers, err = repo.FindOffersByConditions(args)
+	sellerId = 2
+	offers, err = repo.FindOffers(repositories.OfferQuery{SellerId: &sellerId, Name: "Guit"})
 	g.Expect(err).ShouldNot(HaveOccurred())
 	g.Expect(offers).Should(And(HaveLen(1), ContainElements(testOffers[4:5])))
 
@@ -368,12 +356,8 @@ func TestFindOffersByConditions(t *testing.T) {
 		WithArgs(444, 5, "%PC%").
 		WillReturnRows(rows)
 
-	args = map[string]interface{}{
-		"offer_id":  uint(444),
-		"seller_id": uint(5),
-		"name":      "PC",
-	}
-	offers, err = repo.FindOffersByConditions(args)
+	offerId, sellerId = 444, 5
+	offers, err = repo.FindOffers(repositories.OfferQuery{OfferId: &offerId, SellerId: &sellerId, Name: "PC"})
 	g.Expect(err).ShouldNot(HaveOccurred())
 	g.Expect(offers).Should(And(HaveLen(1), ContainElements(testOffers[5:])))
 
@@ -381,3 +365,560 @@ func TestFindOffersByConditions(t *testing.T) {
 	err = mock.ExpectationsWereMet()
 	g.Expect(err).ShouldNot(HaveOccurred())
 }
+
+func TestFindOffers_Page(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+	rows := mock.NewRows([]string{"offer_id", "seller_id", "name"}).
+		AddRow(7, 2, "Guitar").
+		AddRow(9, 2, "Drums")
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM \"offers\" WHERE seller_id = $1 AND (seller_id, offer_id) > ($2, $3) ORDER BY seller_id, offer_id LIMIT 2")).
+		WithArgs(2, 2, 5).
+		WillReturnRows(rows)
+
+	sellerId := uint64(2)
+	offers, err := repo.FindOffers(repositories.OfferQuery{SellerId: &sellerId, Limit: 2, After: &models.Offer{SellerId: 2, OfferId: 5}})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(offers).Should(HaveLen(2))
+	g.Expect(offers[1].OfferId).Should(BeEquivalentTo(9))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM \"offers\" WHERE seller_id = $1 ORDER BY seller_id, offer_id LIMIT 2 OFFSET 4")).
+		WithArgs(2).
+		WillReturnRows(mock.NewRows([]string{"offer_id", "seller_id"}))
+	offers, err = repo.FindOffers(repositories.OfferQuery{SellerId: &sellerId, Limit: 2, Offset: 4})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(offers).Should(BeEmpty())
+
+	// Сортировка по убыванию цены продолжается после цены и ключа последнего товара
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM \"offers\" WHERE seller_id = $1 AND price >= $2 AND available = $3 AND (price, seller_id, offer_id) < ($4, $5, $6) ORDER BY price DESC, seller_id DESC, offer_id DESC LIMIT 2")).
+		WithArgs(2, 100, true, 500, 2, 5).
+		WillReturnRows(mock.NewRows([]string{"offer_id", "seller_id", "price"}).AddRow(3, 2, 400))
+	priceMin, available := int64(100), true
+	offers, err = repo.FindOffers(repositories.OfferQuery{
+		SellerId:  &sellerId,
+		PriceMin:  &priceMin,
+		Available: &available,
+		Sort:      "-price",
+		Limit:     2,
+		After:     &models.Offer{SellerId: 2, OfferId: 5, Price: 500},
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(offers).Should(HaveLen(1))
+
+	_, err = repo.FindOffers(repositories.OfferQuery{SellerId: &sellerId, Sort: "quantity; DROP TABLE offers"})
+	g.Expect(errors.Is(err, repositories.ErrInvalidOfferQuery)).Should(BeTrue())
+
+	since := time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM \"offers\" WHERE price <= $1 AND quantity >= $2 AND updated_at >= $3 ORDER BY updated_at, seller_id, offer_id")).
+		WithArgs(900, 1, since).
+		WillReturnRows(mock.NewRows([]string{"offer_id", "seller_id"}))
+	priceMax, quantityMin := int64(900), 1
+	_, err = repo.FindOffers(repositories.OfferQuery{PriceMax: &priceMax, QuantityMin: &quantityMin, UpdatedSince: &since, Sort: "updated_at"})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM \"offers\" WHERE seller_id = $1")).
+		WithArgs(2).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(6))
+	total, err := repo.CountOffers(repositories.OfferQuery{SellerId: &sellerId})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(total).Should(BeEquivalentTo(6))
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestMigrateOfferSearch(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test: без прав на создание расширения миграция останавливается и возвращает ошибку
+	mock.ExpectExec(regexp.QuoteMeta("CREATE EXTENSION IF NOT EXISTS pg_trgm")).
+		WillReturnError(errors.New("permission denied to create extension"))
+
+	err = repositories.MigrateOfferSearch(repo.GetDB())
+	g.Expect(err).Should(MatchError(ContainSubstring("permission denied")))
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestFindOffers_Search(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+
+	// Слова ищутся по префиксу, символы, которые to_tsquery понял бы как операторы, отбрасываются
+	tsQuery := "red:* & phone:*"
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM \"offers\" WHERE seller_id = $1 AND (search @@ (to_tsquery('russian', $2) || to_tsquery('english', $3)) OR $4 <% name) "+
+		"ORDER BY ts_rank(search, (to_tsquery('russian', $5) || to_tsquery('english', $6))) DESC, word_similarity($7, name) DESC, seller_id, offer_id LIMIT 2 OFFSET 2")).
+		WithArgs(1, tsQuery, tsQuery, "red & phone!", tsQuery, tsQuery, "red & phone!").
+		WillReturnRows(mock.NewRows([]string{"offer_id", "seller_id", "name"}).AddRow(3, 1, "Red phone"))
+
+	sellerId := uint64(1)
+	offers, err := repo.FindOffers(repositories.OfferQuery{SellerId: &sellerId, Search: "red & phone!", Limit: 2, Offset: 2})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(offers).Should(HaveLen(1))
+
+	// С явной сортировкой поиск только фильтрует
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM \"offers\" WHERE search @@ (to_tsquery('russian', $1) || to_tsquery('english', $2)) OR $3 <% name ORDER BY price, seller_id, offer_id")).
+		WithArgs("телефон:*", "телефон:*", "телефон").
+		WillReturnRows(mock.NewRows([]string{"offer_id", "seller_id"}))
+	_, err = repo.FindOffers(repositories.OfferQuery{Search: "телефон", Sort: "price"})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM \"offers\" WHERE search @@ (to_tsquery('russian', $1) || to_tsquery('english', $2)) OR $3 <% name")).
+		WithArgs("phone:*", "phone:*", "phone").
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(4))
+	total, err := repo.CountOffers(repositories.OfferQuery{Search: "phone"})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(total).Should(BeEquivalentTo(4))
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestOfferQuery_Validate(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	negative, price, quantity := int64(-1), int64(100), -1
+	cases := []struct {
+		description string
+		query       repositories.OfferQuery
+		err         string
+	}{
+		{
+			description: "Empty query is valid",
+			query:       repositories.OfferQuery{},
+		},
+		{
+			description: "Descending sort with cursor is valid",
+			query:       repositories.OfferQuery{Sort: "-name", Limit: 10, After: &models.Offer{Name: "a"}},
+		},
+		{
+			description: "Negative price",
+			query:       repositories.OfferQuery{PriceMin: &negative},
+			err:         "price_min",
+		},
+		{
+			description: "Price bounds are swapped",
+			query:       repositories.OfferQuery{PriceMin: &price, PriceMax: new(int64)},
+			err:         "price_min is greater than price_max",
+		},
+		{
+			description: "Negative quantity",
+			query:       repositories.OfferQuery{QuantityMin: &quantity},
+			err:         "quantity_min",
+		},
+		{
+			description: "Offset with cursor",
+			query:       repositories.OfferQuery{Offset: 5, After: &models.Offer{}},
+			err:         "offset",
+		},
+		{
+			description: "Unknown sort field",
+			query:       repositories.OfferQuery{Sort: "-quantity"},
+			err:         "sort",
+		},
+		{
+			description: "Only sort direction",
+			query:       repositories.OfferQuery{Sort: "-"},
+			err:         "sort",
+		},
+		{
+			description: "Search without words",
+			query:       repositories.OfferQuery{Search: "&|!"},
+			err:         "q has no words",
+		},
+		{
+			description: "Cursor in relevance order",
+			query:       repositories.OfferQuery{Search: "phone", After: &models.Offer{}},
+			err:         "cursor",
+		},
+		{
+			description: "Cursor in search with sort is valid",
+			query:       repositories.OfferQuery{Search: "phone", Sort: "price", After: &models.Offer{}},
+		},
+	}
+
+	for _, c := range cases {
+		fmt.Println(c.description)
+		err := c.query.Validate()
+		if c.err == "" {
+			g.Expect(err).ShouldNot(HaveOccurred())
+			continue
+		}
+		g.Expect(errors.Is(err, repositories.ErrInvalidOfferQuery)).Should(BeTrue())
+		g.Expect(err.Error()).Should(ContainSubstring(c.err))
+	}
+}
+
+func TestCreateTask(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+	task := models.Task{
+		Id:         "ac71f2d9-49d3-4ba2-8069-078b945be570",
+		Status:     models.TaskStatusCreated,
+		StatusCode: 201,
+		SellerId:   2,
+		URL:        "https://example.com",
+	}
+
+	mock.ExpectBegin()
+	mock.
+		ExpectExec(regexp.QuoteMeta("INSERT INTO \"tasks\"")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = repo.CreateTask(&task)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestFindTask(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+	rows := mock.NewRows([]string{"id", "status", "status_code", "seller_id", "url", "info_created", "info_errors"}).
+		AddRow("1", models.TaskStatusCompleted, 200, 5, "https://example.com", 10, 2)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM \"tasks\" WHERE id = $1")).
+		WithArgs("1").
+		WillReturnRows(rows)
+
+	task, err := repo.FindTask("1")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(task.Status).Should(Equal(models.TaskStatusCompleted))
+	g.Expect(task.SellerId).Should(BeEquivalentTo(5))
+	g.Expect(task.Info.Created).Should(Equal(10))
+	g.Expect(task.Info.Errors).Should(Equal(2))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM \"tasks\" WHERE id = $1")).
+		WithArgs("2").
+		WillReturnRows(mock.NewRows([]string{"id"}))
+	_, err = repo.FindTask("2")
+	g.Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestFindLastImportTask(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+	rows := mock.NewRows([]string{"id", "status", "status_code", "seller_id", "content_hash"}).
+		AddRow("1", models.TaskStatusCompleted, 200, 5, "abc")
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM \"tasks\" WHERE seller_id = $1 AND dry_run = $2 AND id <> $3 ORDER BY created_at DESC,\"tasks\".\"id\" LIMIT 1")).
+		WithArgs(5, false, "2").
+		WillReturnRows(rows)
+
+	task, err := repo.FindLastImportTask(5, "2")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(task.Id).Should(Equal("1"))
+	g.Expect(task.ContentHash).Should(Equal("abc"))
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestMarkImportsStale(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+	mock.ExpectBegin()
+	mock.
+		ExpectExec(regexp.QuoteMeta("UPDATE \"tasks\" SET \"stale\"=$1,\"updated_at\"=$2 WHERE seller_id = $3 AND stale = $4")).
+		WithArgs(true, AnyTime{}, 5, false).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	err = repo.MarkImportsStale(5)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestFindTaskByIdempotencyKey(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM \"tasks\" WHERE seller_id = $1 AND idempotency_key = $2 ORDER BY \"tasks\".\"id\" LIMIT 1")).
+		WithArgs(5, "key").
+		WillReturnRows(mock.NewRows([]string{"id", "seller_id"}).AddRow("1", 5))
+
+	task, err := repo.FindTaskByIdempotencyKey(5, "key")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(task.Id).Should(Equal("1"))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM \"tasks\" WHERE seller_id = $1 AND idempotency_key = $2")).
+		WithArgs(5, "other").
+		WillReturnRows(mock.NewRows([]string{"id"}))
+	_, err = repo.FindTaskByIdempotencyKey(5, "other")
+	g.Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestUpdateTasksStatus(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+	mock.ExpectBegin()
+	mock.
+		ExpectExec(regexp.QuoteMeta("UPDATE \"tasks\" SET \"status\"=$1,\"status_code\"=$2,\"updated_at\"=$3 WHERE status_code IN ($4,$5,$6)")).
+		WithArgs(models.TaskStatusInterrupted, 500, AnyTime{}, 201, 202, 102).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	n, err := repo.UpdateTasksStatus(models.UnfinishedTaskCodes, models.TaskStatusInterrupted, 500)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(n).Should(BeEquivalentTo(3))
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestFindTaskRowErrors(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM \"task_row_errors\" WHERE task_id = $1")).
+		WithArgs("1").
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(12))
+
+	rows := mock.NewRows([]string{"id", "task_id", "row_number", "column", "value", "reason", "message"}).
+		AddRow(3, "1", 4, "price", "-1", models.RowErrorNegativePrice, "").
+		AddRow(4, "1", 7, "offer_id", "a", models.RowErrorBadOfferId, "invalid syntax")
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM \"task_row_errors\" WHERE task_id = $1 ORDER BY row_number, id LIMIT 2 OFFSET 2")).
+		WithArgs("1").
+		WillReturnRows(rows)
+
+	rowErrors, total, err := repo.FindTaskRowErrors("1", 2, 2)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(total).Should(BeEquivalentTo(12))
+	g.Expect(rowErrors).Should(HaveLen(2))
+	g.Expect(rowErrors[0].Row).Should(Equal(4))
+	g.Expect(rowErrors[1].Reason).Should(Equal(models.RowErrorBadOfferId))
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestTransaction(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+
+	// If function succeeds - changes are committed
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO \"offers\"")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = repo.Transaction(func(txRepo repositories.Repository) error {
+		_, err := txRepo.NewOffer(1, 1, "abc", 100, 1, true)
+		return err
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// If function fails - changes are rolled back
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO \"offers\"")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectRollback()
+
+	sample := errors.New("sample")
+	err = repo.Transaction(func(txRepo repositories.Repository) error {
+		if _, err := txRepo.NewOffer(2, 1, "abc", 100, 1, true); err != nil {
+			return err
+		}
+		return sample
+	})
+	g.Expect(err).Should(Equal(sample))
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestUpsertOffers(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+	offers := []models.Offer{
+		{OfferId: 1, Name: "abc", Price: 100, Quantity: 1, Available: true},
+		{OfferId: 2, Name: "def", Price: 200, Quantity: 2, Available: true},
+		{OfferId: 3, Name: "ghi", Price: 300, Quantity: 3, Available: true},
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO offers (offer_id, seller_id, created_at, updated_at, name, price, quantity, available) VALUES ($1, $2, $3, $4, $5, $6, $7, $8), ($9,")).
+		WithArgs(
+			1, 5, AnyTime{}, AnyTime{}, "abc", 100, 1, true,
+			2, 5, AnyTime{}, AnyTime{}, "def", 200, 2, true,
+			3, 5, AnyTime{}, AnyTime{}, "ghi", 300, 3, true,
+		).
+		WillReturnRows(mock.NewRows([]string{"inserted"}).AddRow(true).AddRow(false).AddRow(true))
+
+	created, updated, err := repo.UpsertOffers(5, offers)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(created).Should(Equal(2))
+	g.Expect(updated).Should(Equal(1))
+
+	// Empty batch doesn't touch the database
+	created, updated, err = repo.UpsertOffers(5, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(created + updated).Should(Equal(0))
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestDeleteOffers(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM \"offers\" WHERE seller_id = $1 AND offer_id IN ($2,$3,$4)")).
+		WithArgs(5, 1, 2, 3).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	n, err := repo.DeleteOffers(5, []uint64{1, 2, 3})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(n).Should(BeEquivalentTo(2))
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestFindDueSchedules(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+	now := time.Date(2021, 1, 1, 3, 0, 0, 0, time.UTC)
+	rows := mock.NewRows([]string{"id", "seller_id", "url", "cron", "paused", "next_run_at"}).
+		AddRow("1", 5, "http://example.com", "0 3 * * *", false, now)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM \"schedules\" WHERE paused = $1 AND next_run_at <= $2 ORDER BY next_run_at")).
+		WithArgs(false, now).
+		WillReturnRows(rows)
+
+	schedules, err := repo.FindDueSchedules(now)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(schedules).Should(HaveLen(1))
+	g.Expect(schedules[0].Cron).Should(Equal("0 3 * * *"))
+	g.Expect(schedules[0].NextRunAt.Equal(now)).Should(BeTrue())
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestDeleteSchedule(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM \"schedules\" WHERE id = $1")).
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := repo.DeleteSchedule("1")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(n).Should(BeEquivalentTo(1))
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestFindScheduleTasks(t *testing.T) {
+	// Before
+	g := NewGomegaWithT(t)
+	mock, repo, err := SetNewMock()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Test
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM \"tasks\" WHERE schedule_id = $1")).
+		WithArgs("1").
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(3))
+
+	rows := mock.NewRows([]string{"id", "status", "status_code", "schedule_id"}).
+		AddRow("b", models.TaskStatusCompleted, 200, "1").
+		AddRow("a", models.TaskStatusNoChanges, 200, "1")
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM \"tasks\" WHERE schedule_id = $1 ORDER BY created_at DESC, id LIMIT 2")).
+		WithArgs("1").
+		WillReturnRows(rows)
+
+	tasks, total, err := repo.FindScheduleTasks("1", 2, 0)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(total).Should(BeEquivalentTo(3))
+	g.Expect(tasks).Should(HaveLen(2))
+	g.Expect(tasks[0].Id).Should(Equal("b"))
+	g.Expect(tasks[1].ScheduleId).Should(Equal("1"))
+
+	// After
+	err = mock.ExpectationsWereMet()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"MartellX/avito-tech-task/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+func (r *PostgresRepository) CreateSchedule(s *models.Schedule) error {
+	res := r.GetDB().Session(&gorm.Session{Logger: silentLogger}).Create(s)
+	return res.Error
+}
+
+func (r *PostgresRepository) SaveSchedule(s *models.Schedule) error {
+	res := r.GetDB().Session(&gorm.Session{Logger: silentLogger}).Save(s)
+	return res.Error
+}
+
+func (r *PostgresRepository) FindSchedule(id string) (*models.Schedule, error) {
+	tx := r.GetDB().Session(&gorm.Session{Logger: silentLogger})
+	var schedule models.Schedule
+
+	result := tx.Where("id = ?", id).First(&schedule)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &schedule, nil
+}
+
+// FindSchedules возвращает расписания продавца в порядке создания
+func (r *PostgresRepository) FindSchedules(sellerId uint64) ([]models.Schedule, error) {
+	tx := r.GetDB().Session(&gorm.Session{Logger: silentLogger})
+	var schedules []models.Schedule
+
+	result := tx.Where("seller_id = ?", sellerId).Order("created_at, id").Find(&schedules)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return schedules, nil
+}
+
+// FindDueSchedules возвращает действующие расписания, время срабатывания которых уже наступило
+func (r *PostgresRepository) FindDueSchedules(now time.Time) ([]models.Schedule, error) {
+	tx := r.GetDB().Session(&gorm.Session{Logger: silentLogger})
+	var schedules []models.Schedule
+
+	result := tx.Where("paused = ? AND next_run_at <= ?", false, now).Order("next_run_at").Find(&schedules)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return schedules, nil
+}
+
+// DeleteSchedule удаляет расписание и возвращает количество удаленных.
+// Задания, созданные по расписанию, остаются
+func (r *PostgresRepository) DeleteSchedule(id string) (int64, error) {
+	res := r.GetDB().Session(&gorm.Session{Logger: silentLogger}).
+		Where("id = ?", id).
+		Delete(&models.Schedule{})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return res.RowsAffected, nil
+}
+
+// FindScheduleTasks возвращает задания, созданные по расписанию, начиная с последнего, и их общее количество
+func (r *PostgresRepository) FindScheduleTasks(scheduleId string, limit, offset int) ([]models.Task, int64, error) {
+	tx := r.GetDB().Session(&gorm.Session{Logger: silentLogger})
+
+	var total int64
+	if res := tx.Model(&models.Task{}).Where("schedule_id = ?", scheduleId).Count(&total); res.Error != nil {
+		return nil, 0, res.Error
+	}
+
+	var tasks []models.Task
+	query := tx.Where("schedule_id = ?", scheduleId).Order("created_at DESC, id").Offset(offset)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if res := query.Find(&tasks); res.Error != nil {
+		return nil, 0, res.Error
+	}
+	return tasks, total, nil
+}
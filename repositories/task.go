@@ -0,0 +1,104 @@
+package repositories
+
+import (
+	"MartellX/avito-tech-task/models"
+	"gorm.io/gorm"
+)
+
+func (r *PostgresRepository) CreateTask(t *models.Task) error {
+	res := r.GetDB().Session(&gorm.Session{Logger: silentLogger}).Create(t)
+	return res.Error
+}
+
+// SaveTask сохраняет задание. Пометку Stale меняет только MarkImportsStale, выполняющееся задание ее не затирает
+func (r *PostgresRepository) SaveTask(t *models.Task) error {
+	res := r.GetDB().Session(&gorm.Session{Logger: silentLogger}).Omit("Stale").Save(t)
+	return res.Error
+}
+
+func (r *PostgresRepository) FindTask(id string) (*models.Task, error) {
+	tx := r.GetDB().Session(&gorm.Session{Logger: silentLogger})
+	var task models.Task
+
+	result := tx.Where("id = ?", id).First(&task)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &task, nil
+}
+
+// FindLastImportTask возвращает последнее задание продавца, кроме excludeId, которое могло изменить товары,
+// то есть не пробный запуск. Статус не учитывается: прерванное или отмененное задание тоже могло записать строки
+func (r *PostgresRepository) FindLastImportTask(sellerId uint64, excludeId string) (*models.Task, error) {
+	tx := r.GetDB().Session(&gorm.Session{Logger: silentLogger})
+	var task models.Task
+
+	result := tx.Where("seller_id = ? AND dry_run = ? AND id <> ?", sellerId, false, excludeId).
+		Order("created_at DESC").
+		First(&task)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &task, nil
+}
+
+// MarkImportsStale помечает задания продавца устаревшими после изменения его товаров через API
+func (r *PostgresRepository) MarkImportsStale(sellerId uint64) error {
+	res := r.GetDB().Session(&gorm.Session{Logger: silentLogger}).Model(&models.Task{}).
+		Where("seller_id = ? AND stale = ?", sellerId, false).
+		Update("stale", true)
+	return res.Error
+}
+
+// FindTaskByIdempotencyKey возвращает задание продавца, созданное с ключом идемпотентности key
+func (r *PostgresRepository) FindTaskByIdempotencyKey(sellerId uint64, key string) (*models.Task, error) {
+	tx := r.GetDB().Session(&gorm.Session{Logger: silentLogger})
+	var task models.Task
+
+	result := tx.Where("seller_id = ? AND idempotency_key = ?", sellerId, key).First(&task)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &task, nil
+}
+
+// UpdateTasksStatus выставляет новый статус всем заданиям с одним из кодов fromCodes
+// и возвращает количество затронутых заданий
+func (r *PostgresRepository) UpdateTasksStatus(fromCodes []int, status string, code int) (int64, error) {
+	res := r.GetDB().Model(&models.Task{}).
+		Where("status_code IN ?", fromCodes).
+		Updates(map[string]interface{}{"status": status, "status_code": code})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return res.RowsAffected, nil
+}
+
+func (r *PostgresRepository) CreateTaskRowErrors(errs []models.TaskRowError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	res := r.GetDB().Session(&gorm.Session{Logger: silentLogger}).Create(&errs)
+	return res.Error
+}
+
+// FindTaskRowErrors возвращает ошибки задания в порядке строк и их общее количество.
+// При limit <= 0 возвращаются все ошибки начиная с offset
+func (r *PostgresRepository) FindTaskRowErrors(taskId string, limit, offset int) ([]models.TaskRowError, int64, error) {
+	tx := r.GetDB().Session(&gorm.Session{Logger: silentLogger})
+
+	var total int64
+	if res := tx.Model(&models.TaskRowError{}).Where("task_id = ?", taskId).Count(&total); res.Error != nil {
+		return nil, 0, res.Error
+	}
+
+	var errs []models.TaskRowError
+	query := tx.Where("task_id = ?", taskId).Order("row_number, id").Offset(offset)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if res := query.Find(&errs); res.Error != nil {
+		return nil, 0, res.Error
+	}
+	return errs, total, nil
+}
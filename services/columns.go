@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrMissingColumns = errors.New("missing required columns")
+
+// Известные названия колонок в заголовке таблицы, в нижнем регистре
+var columnAliases = map[string]int{
+	"offer_id":     0,
+	"offer id":     0,
+	"id":           0,
+	"sku":          0,
+	"артикул":      0,
+	"id товара":    0,
+	"код товара":   0,
+	"name":         1,
+	"title":        1,
+	"название":     1,
+	"наименование": 1,
+	"товар":        1,
+	"price":        2,
+	"цена":         2,
+	"стоимость":    2,
+	"quantity":     3,
+	"qty":          3,
+	"stock":        3,
+	"количество":   3,
+	"кол-во":       3,
+	"остаток":      3,
+	"available":    4,
+	"в наличии":    4,
+	"наличие":      4,
+	"доступен":     4,
+	"доступность":  4,
+}
+
+// KnownColumn сообщает, есть ли колонка с таким названием среди колонок товара
+func KnownColumn(name string) bool {
+	for _, column := range columnNames {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// columnMapping - номера ячеек строки, в которых находятся колонки columnNames
+type columnMapping [len(columnNames)]int
+
+// Колонки по порядку, без заголовка. Так раскладываются поля JSON-фида
+var positionalColumns = columnMapping{0, 1, 2, 3, 4}
+
+// normalizeHeader приводит название колонки к нижнему регистру и убирает лишние пробелы
+func normalizeHeader(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+// mapColumns находит колонки товара по заголовку таблицы. Явно заданные в explicit названия колонок
+// (или их номера, начиная с 1) имеют приоритет над известными названиями.
+// Если какой-то колонки нет, возвращается ErrMissingColumns со списком недостающих
+func mapColumns(header []string, explicit map[string]string) (columnMapping, error) {
+	var mapping columnMapping
+	used := map[int]bool{}
+	for i, name := range columnNames {
+		mapping[i] = -1
+		title, ok := explicit[name]
+		if !ok {
+			continue
+		}
+		cell := findHeader(header, title)
+		if cell < 0 {
+			return mapping, fmt.Errorf("%w: column %q for %s is not found in header", ErrMissingColumns, title, name)
+		}
+		mapping[i] = cell
+		used[cell] = true
+	}
+
+	for cell, title := range header {
+		column, ok := columnAliases[normalizeHeader(title)]
+		// При повторе названия используется первая колонка
+		if !ok || used[cell] || mapping[column] >= 0 {
+			continue
+		}
+		mapping[column] = cell
+		used[cell] = true
+	}
+
+	var missing []string
+	for i, cell := range mapping {
+		if cell < 0 {
+			missing = append(missing, columnNames[i])
+		}
+	}
+	if len(missing) > 0 {
+		return mapping, fmt.Errorf("%w: %s", ErrMissingColumns, strings.Join(missing, ", "))
+	}
+	return mapping, nil
+}
+
+// findHeader возвращает номер ячейки заголовка с названием title или -1
+func findHeader(header []string, title string) int {
+	normalized := normalizeHeader(title)
+	for cell, value := range header {
+		if normalizeHeader(value) == normalized {
+			return cell
+		}
+	}
+	if n, err := strconv.Atoi(title); err == nil && n >= 1 && n <= len(header) {
+		return n - 1
+	}
+	return -1
+}
+
+// cells возвращает количество ячеек, которое должно быть в строке, чтобы в ней были все колонки
+func (m columnMapping) cells() int {
+	max := 0
+	for _, cell := range m {
+		if cell+1 > max {
+			max = cell + 1
+		}
+	}
+	return max
+}
+
+// jsonFields возвращает названия полей JSON-фида для колонок columnNames с учетом явно заданных
+func jsonFields(explicit map[string]string) [len(columnNames)]string {
+	var fields [len(columnNames)]string
+	for i, name := range columnNames {
+		fields[i] = name
+		if field, ok := explicit[name]; ok {
+			fields[i] = field
+		}
+	}
+	return fields
+}
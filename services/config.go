@@ -0,0 +1,71 @@
+package services
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+type Config struct {
+	// Количество одновременно выполняющихся заданий
+	Workers int
+	// Сколько заданий может ожидать в очереди, сверх этого новые задания отклоняются
+	QueueSize int
+	// Размер пачки для записи товаров одним запросом INSERT ... ON CONFLICT, не больше repositories.MaxUpsertBatchSize.
+	// 0 - каждая строка записывается отдельными запросами
+	BatchSize int
+	// Ограничения на загружаемую таблицу: размер файла в байтах и количество строк. 0 - без ограничения
+	MaxFileSize int
+	MaxRows     int
+	// Каталог для временных файлов со скачанными и загруженными таблицами, пустой - системный каталог
+	SpoolDir string
+	// Отправка завершенных заданий на callback_url: секрет для подписи HMAC-SHA256 (пустой - без подписи),
+	// количество попыток и задержка перед второй попыткой, каждая следующая задержка вдвое больше
+	WebhookSecret   string
+	WebhookAttempts int
+	WebhookBackoff  time.Duration
+	// Как часто планировщик проверяет, не пора ли запустить импорт по расписанию
+	SchedulePollInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Workers:     4,
+		QueueSize:   100,
+		MaxFileSize: 100 << 20,
+		MaxRows:     1000000,
+
+		WebhookAttempts: 5,
+		WebhookBackoff:  time.Second,
+
+		SchedulePollInterval: 30 * time.Second,
+	}
+}
+
+// ConfigFromEnvironments берет значения по умолчанию и переопределяет те, что заданы в переменных окружения
+func ConfigFromEnvironments() Config {
+	cfg := DefaultConfig()
+	cfg.Workers = intFromEnv("workers", cfg.Workers)
+	cfg.QueueSize = intFromEnv("queue_size", cfg.QueueSize)
+	cfg.BatchSize = intFromEnv("batch_size", cfg.BatchSize)
+	cfg.MaxFileSize = intFromEnv("max_file_size", cfg.MaxFileSize)
+	cfg.MaxRows = intFromEnv("max_rows", cfg.MaxRows)
+	cfg.SpoolDir = os.Getenv("spool_dir")
+	cfg.WebhookSecret = os.Getenv("webhook_secret")
+	cfg.WebhookAttempts = intFromEnv("webhook_attempts", cfg.WebhookAttempts)
+	cfg.WebhookBackoff = time.Duration(intFromEnv("webhook_backoff_ms", int(cfg.WebhookBackoff/time.Millisecond))) * time.Millisecond
+	cfg.SchedulePollInterval = time.Duration(intFromEnv("schedule_poll_ms", int(cfg.SchedulePollInterval/time.Millisecond))) * time.Millisecond
+	return cfg
+}
+
+func intFromEnv(key string, def int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"golang.org/x/text/encoding/charmap"
+	"io"
+	"strings"
+)
+
+// csvReader читает строки CSV или TSV по одной
+type csvReader struct {
+	reader *csv.Reader
+	row    int
+}
+
+// newCsvReader создает чтение CSV с разделителем delimiter. Если delimiter не задан, он определяется по первой строке
+func newCsvReader(r io.Reader, delimiter rune, encoding string) (*csvReader, error) {
+	if encoding == EncodingWindows1251 {
+		r = charmap.Windows1251.NewDecoder().Reader(r)
+	}
+	br := bufio.NewReader(r)
+	// Excel сохраняет CSV в UTF-8 с BOM
+	if bom, err := br.Peek(3); err == nil && bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		br.Discard(3)
+	}
+
+	if delimiter == 0 {
+		header, err := br.Peek(br.Size())
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+		delimiter = detectDelimiter(header)
+	}
+
+	reader := csv.NewReader(br)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	return &csvReader{reader: reader}, nil
+}
+
+// detectDelimiter выбирает из ';', ',' и табуляции символ, который чаще встречается в первой строке
+func detectDelimiter(head []byte) rune {
+	line := string(head)
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	delimiter, max := ';', 0
+	for _, candidate := range []rune{';', ',', '\t'} {
+		if n := strings.Count(line, string(candidate)); n > max {
+			delimiter, max = candidate, n
+		}
+	}
+	return delimiter
+}
+
+func (r *csvReader) Next() ([]string, int, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		return nil, 0, err
+	}
+	r.row++
+	return record, r.row, nil
+}
+
+// countRows дочитывает таблицу до конца и возвращает количество строк
+func (r *csvReader) countRows() (int, error) {
+	for {
+		_, _, err := r.Next()
+		if err == io.EOF {
+			return r.row, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (r *csvReader) Close() error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+var (
+	ErrFileTooLarge = errors.New("file is too large")
+	ErrTooManyRows  = errors.New("too many rows")
+)
+
+// UploadedFile - таблица, загруженная в запросе вместо ссылки
+type UploadedFile struct {
+	Name        string
+	ContentType string
+	Body        io.Reader
+}
+
+// spooledFile - таблица, сохраненная во временный файл
+type spooledFile struct {
+	file *os.File
+	size int64
+	// Ссылка или имя загруженного файла и Content-Type, по ним определяется формат
+	name        string
+	contentType string
+	// sha256 содержимого в hex
+	hash string
+}
+
+// reader возвращает независимое чтение файла с начала, файл можно читать несколько раз
+func (f *spooledFile) reader() *io.SectionReader {
+	return io.NewSectionReader(f.file, 0, f.size)
+}
+
+// remove закрывает и удаляет временный файл
+func (f *spooledFile) remove() {
+	f.file.Close()
+	os.Remove(f.file.Name())
+}
+
+// spoolFile сохраняет содержимое body во временный файл в каталоге dir (пустой - системный каталог временных файлов).
+// Если содержимое больше maxSize байт, сохранение прерывается с ErrFileTooLarge. Временный файл удаляет вызывающий через remove
+func spoolFile(dir string, body io.Reader, maxSize int64) (*spooledFile, error) {
+	f, err := ioutil.TempFile(dir, "merchantx-*")
+	if err != nil {
+		return nil, err
+	}
+	spooled := &spooledFile{file: f}
+
+	if maxSize > 0 {
+		// Читаем на байт больше лимита, чтобы отличить файл ровно в maxSize от файла больше него
+		body = io.LimitReader(body, maxSize+1)
+	}
+	hash := sha256.New()
+	spooled.size, err = io.Copy(io.MultiWriter(f, hash), body)
+	if err == nil && maxSize > 0 && spooled.size > maxSize {
+		err = fmt.Errorf("%w: limit is %d bytes", ErrFileTooLarge, maxSize)
+	}
+	if err != nil {
+		spooled.remove()
+		return nil, err
+	}
+	spooled.hash = hex.EncodeToString(hash.Sum(nil))
+	return spooled, nil
+}
+
+// downloadFile скачивает файл по ссылке во временный файл, чтобы не держать его в памяти
+func downloadFile(ctx context.Context, url string, dir string, maxSize int64) (*spooledFile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("%w: %d bytes, limit is %d", ErrFileTooLarge, resp.ContentLength, maxSize)
+	}
+
+	spooled, err := spoolFile(dir, resp.Body, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	spooled.name = url
+	spooled.contentType = resp.Header.Get("Content-Type")
+	return spooled, nil
+}
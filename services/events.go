@@ -0,0 +1,129 @@
+package services
+
+import "MartellX/avito-tech-task/models"
+
+// Типы событий задания
+const (
+	EventStatus   = "status"
+	EventProgress = "progress"
+)
+
+// TaskEvent - состояние задания, которое получают подписчики: статус и счетчики обработанных строк
+type TaskEvent struct {
+	Type       string          `json:"-"`
+	Status     string          `json:"status"`
+	StatusCode int             `json:"status_code"`
+	Processed  int             `json:"processed"`
+	Total      int             `json:"total"`
+	Info       models.TaskInfo `json:"info"`
+}
+
+// SubscribeTask подписывается на события задания. Канал закрывается, когда задание завершится,
+// последним событием приходит итоговый статус. Если подписчик не успевает читать, он получает только последнее событие.
+// unsubscribe нужно вызвать, если события больше не нужны до завершения задания
+func (s *TaskServiceImpl) SubscribeTask(id string) (events <-chan TaskEvent, unsubscribe func(), err error) {
+	s.mu.RLock()
+	state, ok := s.active[id]
+	s.mu.RUnlock()
+	if ok {
+		ch := state.subscribe()
+		return ch, func() { state.unsubscribe(ch) }, nil
+	}
+
+	// Завершенное задание отдает одно итоговое событие
+	task, found := s.GetTask(id)
+	if !found {
+		return nil, nil, ErrTaskNotFound
+	}
+	ch := make(chan TaskEvent, 1)
+	ch <- TaskEvent{Type: EventStatus, Status: task.Status, StatusCode: task.StatusCode, Info: task.Info}
+	close(ch)
+	return ch, func() {}, nil
+}
+
+// event возвращает текущее состояние задания. Вызывается под мьютексом
+func (ts *taskState) event(eventType string) TaskEvent {
+	info := ts.task.Info
+	info.Sheets = append(models.SheetsInfo(nil), info.Sheets...)
+	return TaskEvent{
+		Type:       eventType,
+		Status:     ts.task.Status,
+		StatusCode: ts.task.StatusCode,
+		Processed:  ts.task.ProcessedRows,
+		Total:      ts.task.TotalRows,
+		Info:       info,
+	}
+}
+
+func (ts *taskState) subscribe() chan TaskEvent {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ch := make(chan TaskEvent, 1)
+	ch <- ts.event(EventStatus)
+	if ts.finished {
+		close(ch)
+		return ch
+	}
+	if ts.subscribers == nil {
+		ts.subscribers = map[chan TaskEvent]struct{}{}
+	}
+	ts.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (ts *taskState) unsubscribe(ch chan TaskEvent) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if _, ok := ts.subscribers[ch]; ok {
+		delete(ts.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish отправляет текущее состояние подписчикам. Вызывается под мьютексом.
+// Непрочитанное событие заменяется новым, чтобы медленный подписчик не задерживал задание
+func (ts *taskState) publish(eventType string) {
+	if len(ts.subscribers) == 0 {
+		return
+	}
+	event := ts.event(eventType)
+	for ch := range ts.subscribers {
+		select {
+		case ch <- event:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- event
+		}
+	}
+}
+
+// closeSubscribers отправляет итоговое состояние и закрывает каналы подписчиков
+func (ts *taskState) closeSubscribers() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.publish(EventStatus)
+	for ch := range ts.subscribers {
+		close(ch)
+	}
+	ts.subscribers = nil
+	ts.finished = true
+}
+
+// setTotal запоминает количество строк с товарами в таблице
+func (ts *taskState) setTotal(total int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.task.TotalRows = total
+	ts.publish(EventProgress)
+}
+
+// setProcessed запоминает количество обработанных строк и сообщает подписчикам
+func (ts *taskState) setProcessed(processed int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.task.ProcessedRows = processed
+	ts.publish(EventProgress)
+}
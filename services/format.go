@@ -0,0 +1,202 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Первые байты zip-архива, xlsx - это zip
+var zipMagic = []byte("PK\x03\x04")
+
+// detectFormat определяет формат таблицы: явно заданный в параметрах, затем по Content-Type,
+// по расширению файла в ссылке и, если ничего не подошло, по первым байтам файла
+func detectFormat(explicit string, f *spooledFile) string {
+	if explicit != "" {
+		return explicit
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(f.contentType); err == nil {
+		switch mediaType {
+		case "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
+			return FormatXLSX
+		case "text/csv":
+			return FormatCSV
+		case "text/tab-separated-values":
+			return FormatTSV
+		case "application/json":
+			return FormatJSON
+		case "application/x-ndjson", "application/jsonl":
+			return FormatNDJSON
+		}
+	}
+
+	if u, err := url.Parse(f.name); err == nil {
+		switch strings.ToLower(path.Ext(u.Path)) {
+		case ".xlsx":
+			return FormatXLSX
+		case ".csv":
+			return FormatCSV
+		case ".tsv":
+			return FormatTSV
+		case ".json":
+			return FormatJSON
+		case ".ndjson", ".jsonl":
+			return FormatNDJSON
+		}
+	}
+
+	head := make([]byte, 512)
+	n, _ := f.reader().Read(head)
+	head = head[:n]
+	if bytes.HasPrefix(head, zipMagic) {
+		return FormatXLSX
+	}
+	switch trimmed := bytes.TrimLeft(head, " \t\r\n"); {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return FormatJSON
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return FormatNDJSON
+	}
+	return FormatCSV
+}
+
+// tableSheet - часть таблицы со своим заголовком: лист книги xlsx или весь файл в остальных форматах
+type tableSheet struct {
+	// Имя листа, которое попадает в ошибки строк. Пустое, если лист не выбирался явно
+	name    string
+	reader  rowReader
+	columns columnMapping
+	// Количество строк с товарами
+	total int
+}
+
+// closeSheets закрывает чтение всех листов
+func closeSheets(sheets []tableSheet) {
+	for _, sheet := range sheets {
+		sheet.reader.Close()
+	}
+}
+
+// openTable открывает таблицу в заданном формате и возвращает ее листы с товарами.
+// Заголовки листов к этому моменту уже прочитаны и сопоставлены с колонками
+func openTable(format string, f *spooledFile, opts TaskOptions) ([]tableSheet, error) {
+	if opts.Sheet != "" && format != FormatXLSX {
+		return nil, fmt.Errorf("sheet selection is not supported for %s", format)
+	}
+
+	switch format {
+	case FormatXLSX:
+		return openXlsxSheets(f, opts)
+
+	case FormatCSV, FormatTSV:
+		delimiter := opts.Delimiter
+		if delimiter == 0 && format == FormatTSV {
+			delimiter = '\t'
+		}
+		// Строки считаются отдельным проходом по файлу, чтобы не держать таблицу в памяти
+		counter, err := newCsvReader(f.reader(), delimiter, opts.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		total, err := counter.countRows()
+		if err != nil {
+			return nil, err
+		}
+		reader, err := newCsvReader(f.reader(), delimiter, opts.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		columns, total, err := readHeader(reader, total, opts.Columns)
+		if err != nil {
+			return nil, err
+		}
+		return []tableSheet{{reader: reader, columns: columns, total: total}}, nil
+
+	case FormatJSON, FormatNDJSON:
+		// В JSON заголовка нет, номер строки - порядковый номер объекта
+		fields := jsonFields(opts.Columns)
+		counter, err := newJsonReader(f.reader(), fields)
+		if err != nil {
+			return nil, err
+		}
+		total, err := counter.countRows()
+		if err != nil {
+			return nil, err
+		}
+		reader, err := newJsonReader(f.reader(), fields)
+		if err != nil {
+			return nil, err
+		}
+		return []tableSheet{{reader: reader, columns: positionalColumns, total: total}}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// openXlsxSheets открывает выбранные листы книги. При импорте всех листов пустые листы пропускаются
+func openXlsxSheets(f *spooledFile, opts TaskOptions) ([]tableSheet, error) {
+	wb, err := openXlsxWorkbook(f.reader(), f.size)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := wb.selectSheets(opts.Sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	var sheets []tableSheet
+	for _, i := range selected {
+		reader, err := wb.openSheet(i)
+		if err != nil {
+			closeSheets(sheets)
+			return nil, err
+		}
+		total, err := reader.countRows()
+		if err != nil {
+			reader.Close()
+			closeSheets(sheets)
+			return nil, err
+		}
+		if total == 0 && opts.Sheet == AllSheets {
+			reader.Close()
+			continue
+		}
+		sheet := tableSheet{reader: reader}
+		if opts.Sheet != "" {
+			sheet.name = wb.sheets[i].name
+		}
+		sheet.columns, sheet.total, err = readHeader(reader, total, opts.Columns)
+		if err != nil {
+			reader.Close()
+			closeSheets(sheets)
+			if sheet.name != "" {
+				return nil, fmt.Errorf("sheet %q: %w", sheet.name, err)
+			}
+			return nil, err
+		}
+		sheets = append(sheets, sheet)
+	}
+	return sheets, nil
+}
+
+// readHeader читает первую строку таблицы, находит по ней колонки товара
+// и возвращает их вместе с количеством оставшихся строк
+func readHeader(reader rowReader, total int, explicit map[string]string) (columnMapping, int, error) {
+	if total == 0 {
+		return positionalColumns, 0, nil
+	}
+	header, _, err := reader.Next()
+	if err != nil {
+		return columnMapping{}, 0, err
+	}
+	columns, err := mapColumns(header, explicit)
+	if err != nil {
+		return columnMapping{}, 0, err
+	}
+	return columns, total - 1, nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"MartellX/avito-tech-task/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+)
+
+// importHash возвращает хеш содержимого файла вместе с параметрами, от которых зависит результат импорта.
+// Тот же файл, разобранный по-другому, считается другим импортом
+func importHash(contentHash string, format string, opts TaskOptions) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%q\n%s\n%q\n%s\n", contentHash, format, opts.Mode,
+		opts.Delimiter, opts.Encoding, opts.DecimalSeparator, opts.Sheet)
+	for _, name := range columnNames {
+		fmt.Fprintf(h, "%s=%s\n", name, opts.Columns[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// findUnchangedImport возвращает последний импорт продавца, если он был из того же файла с теми же параметрами
+// и применил его целиком. Пробные запуски и задания с Force всегда выполняются, как и повтор импорта,
+// после которого товары менялись: другим заданием, в том числе незавершенным, или через API
+func (s *TaskServiceImpl) findUnchangedImport(state *taskState, hash string) *Task {
+	if state.opts.DryRun || state.opts.Force {
+		return nil
+	}
+	previous, err := s.repo.FindLastImportTask(state.sellerId(), state.id())
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			log.Error(err)
+		}
+		return nil
+	}
+	if previous.Status != models.TaskStatusCompleted && previous.Status != models.TaskStatusNoChanges {
+		return nil
+	}
+	if previous.ContentHash != hash || previous.DbFailures > 0 || previous.Stale {
+		return nil
+	}
+	return previous
+}
+
+// findIdempotentTask ищет задание продавца с ключом идемпотентности key среди выполняющихся и в базе
+func (s *TaskServiceImpl) findIdempotentTask(sellerId uint64, key string) (*Task, error) {
+	s.mu.RLock()
+	for _, state := range s.active {
+		if task := s.snapshot(state); task.SellerId == sellerId && task.IdempotencyKey == key {
+			s.mu.RUnlock()
+			return task, nil
+		}
+	}
+	s.mu.RUnlock()
+
+	task, err := s.repo.FindTaskByIdempotencyKey(sellerId, key)
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	return task, err
+}
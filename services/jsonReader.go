@@ -0,0 +1,118 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// jsonReader читает товары из JSON-массива или NDJSON по одному объекту.
+// Поля объекта раскладываются по ячейкам в порядке columnNames, чтобы строки проверялись так же, как в таблицах
+type jsonReader struct {
+	decoder *json.Decoder
+	array   bool
+	row     int
+	// Названия полей с колонками columnNames
+	fields [len(columnNames)]string
+}
+
+var errNotJsonFeed = errors.New("json: expected an array or newline-delimited objects")
+
+func newJsonReader(r io.Reader, fields [len(columnNames)]string) (*jsonReader, error) {
+	br := bufio.NewReader(r)
+	reader := &jsonReader{fields: fields}
+
+	// Массив или поток объектов определяется по первому значащему символу
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if bytes.IndexByte([]byte(" \t\r\n"), b) >= 0 {
+			continue
+		}
+		br.UnreadByte()
+		switch b {
+		case '[':
+			reader.array = true
+		case '{':
+		default:
+			return nil, errNotJsonFeed
+		}
+		break
+	}
+
+	reader.decoder = json.NewDecoder(br)
+	reader.decoder.UseNumber()
+	if reader.array {
+		// Открывающая скобка массива
+		if _, err := reader.decoder.Token(); err != nil {
+			return nil, err
+		}
+	}
+	return reader, nil
+}
+
+func (r *jsonReader) Next() ([]string, int, error) {
+	if r.array && !r.decoder.More() {
+		return nil, 0, io.EOF
+	}
+	var item interface{}
+	if err := r.decoder.Decode(&item); err != nil {
+		return nil, 0, err
+	}
+	r.row++
+
+	offer, ok := item.(map[string]interface{})
+	if !ok {
+		return nil, r.row, nil
+	}
+	cells := make([]string, len(r.fields))
+	for i, field := range r.fields {
+		cells[i] = jsonCell(offer[field])
+	}
+	return cells, r.row, nil
+}
+
+// jsonCell приводит значение поля к строке так, как оно выглядело бы в ячейке таблицы
+func jsonCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+// countRows дочитывает поток до конца и возвращает количество объектов
+func (r *jsonReader) countRows() (int, error) {
+	for {
+		var item json.RawMessage
+		if r.array && !r.decoder.More() {
+			return r.row, nil
+		}
+		if err := r.decoder.Decode(&item); err == io.EOF {
+			return r.row, nil
+		} else if err != nil {
+			return 0, err
+		}
+		r.row++
+	}
+}
+
+func (r *jsonReader) Close() error {
+	return nil
+}
@@ -5,6 +5,7 @@
 package mock_services
 
 import (
+	models "MartellX/avito-tech-task/models"
 	services "MartellX/avito-tech-task/services"
 	reflect "reflect"
 
@@ -34,6 +35,36 @@ func (m *MockTaskService) EXPECT() *MockTaskServiceMockRecorder {
 	return m.recorder
 }
 
+// CancelTask mock_services base method.
+func (m *MockTaskService) CancelTask(id string) (*services.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelTask", id)
+	ret0, _ := ret[0].(*services.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CancelTask indicates an expected call of CancelTask.
+func (mr *MockTaskServiceMockRecorder) CancelTask(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelTask", reflect.TypeOf((*MockTaskService)(nil).CancelTask), id)
+}
+
+// CheckNewTask mock_services base method.
+func (m *MockTaskService) CheckNewTask(sellerId uint64, idempotencyKey string) (*services.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckNewTask", sellerId, idempotencyKey)
+	ret0, _ := ret[0].(*services.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckNewTask indicates an expected call of CheckNewTask.
+func (mr *MockTaskServiceMockRecorder) CheckNewTask(sellerId, idempotencyKey interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckNewTask", reflect.TypeOf((*MockTaskService)(nil).CheckNewTask), sellerId, idempotencyKey)
+}
+
 // GetTask mock_services base method.
 func (m *MockTaskService) GetTask(id string) (*services.Task, bool) {
 	m.ctrl.T.Helper()
@@ -49,17 +80,162 @@ func (mr *MockTaskServiceMockRecorder) GetTask(id interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTask", reflect.TypeOf((*MockTaskService)(nil).GetTask), id)
 }
 
+// GetTaskErrors mock_services base method.
+func (m *MockTaskService) GetTaskErrors(id string, limit, offset int) ([]models.TaskRowError, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTaskErrors", id, limit, offset)
+	ret0, _ := ret[0].([]models.TaskRowError)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetTaskErrors indicates an expected call of GetTaskErrors.
+func (mr *MockTaskServiceMockRecorder) GetTaskErrors(id, limit, offset interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTaskErrors", reflect.TypeOf((*MockTaskService)(nil).GetTaskErrors), id, limit, offset)
+}
+
+// StartUploadingFileTask mock_services base method.
+func (m *MockTaskService) StartUploadingFileTask(sellerId uint64, upload services.UploadedFile, opts services.TaskOptions) (*services.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StartUploadingFileTask", sellerId, upload, opts)
+	ret0, _ := ret[0].(*services.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StartUploadingFileTask indicates an expected call of StartUploadingFileTask.
+func (mr *MockTaskServiceMockRecorder) StartUploadingFileTask(sellerId, upload, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartUploadingFileTask", reflect.TypeOf((*MockTaskService)(nil).StartUploadingFileTask), sellerId, upload, opts)
+}
+
 // StartUploadingTask mock_services base method.
-func (m *MockTaskService) StartUploadingTask(sellerId uint64, xlsxURL string) (*services.Task, error) {
+func (m *MockTaskService) StartUploadingTask(sellerId uint64, xlsxURL string, opts services.TaskOptions) (*services.Task, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "StartUploadingTask", sellerId, xlsxURL)
+	ret := m.ctrl.Call(m, "StartUploadingTask", sellerId, xlsxURL, opts)
 	ret0, _ := ret[0].(*services.Task)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // StartUploadingTask indicates an expected call of StartUploadingTask.
-func (mr *MockTaskServiceMockRecorder) StartUploadingTask(sellerId, xlsxURL interface{}) *gomock.Call {
+func (mr *MockTaskServiceMockRecorder) StartUploadingTask(sellerId, xlsxURL, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartUploadingTask", reflect.TypeOf((*MockTaskService)(nil).StartUploadingTask), sellerId, xlsxURL, opts)
+}
+
+// SubscribeTask mock_services base method.
+func (m *MockTaskService) SubscribeTask(arg0 string) (<-chan services.TaskEvent, func(), error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubscribeTask", arg0)
+	ret0, _ := ret[0].(<-chan services.TaskEvent)
+	ret1, _ := ret[1].(func())
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SubscribeTask indicates an expected call of SubscribeTask.
+func (mr *MockTaskServiceMockRecorder) SubscribeTask(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeTask", reflect.TypeOf((*MockTaskService)(nil).SubscribeTask), arg0)
+}
+
+// MockScheduleService is a mock of ScheduleService interface.
+type MockScheduleService struct {
+	ctrl     *gomock.Controller
+	recorder *MockScheduleServiceMockRecorder
+}
+
+// MockScheduleServiceMockRecorder is the mock recorder for MockScheduleService.
+type MockScheduleServiceMockRecorder struct {
+	mock *MockScheduleService
+}
+
+// NewMockScheduleService creates a new mock instance.
+func NewMockScheduleService(ctrl *gomock.Controller) *MockScheduleService {
+	mock := &MockScheduleService{ctrl: ctrl}
+	mock.recorder = &MockScheduleServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockScheduleService) EXPECT() *MockScheduleServiceMockRecorder {
+	return m.recorder
+}
+
+// CreateSchedule mock_services base method.
+func (m *MockScheduleService) CreateSchedule(sellerId uint64, url, cron string) (*models.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSchedule", sellerId, url, cron)
+	ret0, _ := ret[0].(*models.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateSchedule indicates an expected call of CreateSchedule.
+func (mr *MockScheduleServiceMockRecorder) CreateSchedule(sellerId, url, cron interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSchedule", reflect.TypeOf((*MockScheduleService)(nil).CreateSchedule), sellerId, url, cron)
+}
+
+// DeleteSchedule mock_services base method.
+func (m *MockScheduleService) DeleteSchedule(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSchedule", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSchedule indicates an expected call of DeleteSchedule.
+func (mr *MockScheduleServiceMockRecorder) DeleteSchedule(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSchedule", reflect.TypeOf((*MockScheduleService)(nil).DeleteSchedule), id)
+}
+
+// GetScheduleTasks mock_services base method.
+func (m *MockScheduleService) GetScheduleTasks(id string, limit, offset int) ([]models.Task, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetScheduleTasks", id, limit, offset)
+	ret0, _ := ret[0].([]models.Task)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetScheduleTasks indicates an expected call of GetScheduleTasks.
+func (mr *MockScheduleServiceMockRecorder) GetScheduleTasks(id, limit, offset interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetScheduleTasks", reflect.TypeOf((*MockScheduleService)(nil).GetScheduleTasks), id, limit, offset)
+}
+
+// GetSchedules mock_services base method.
+func (m *MockScheduleService) GetSchedules(sellerId uint64) ([]models.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSchedules", sellerId)
+	ret0, _ := ret[0].([]models.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSchedules indicates an expected call of GetSchedules.
+func (mr *MockScheduleServiceMockRecorder) GetSchedules(sellerId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSchedules", reflect.TypeOf((*MockScheduleService)(nil).GetSchedules), sellerId)
+}
+
+// PauseSchedule mock_services base method.
+func (m *MockScheduleService) PauseSchedule(id string, paused bool) (*models.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PauseSchedule", id, paused)
+	ret0, _ := ret[0].(*models.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PauseSchedule indicates an expected call of PauseSchedule.
+func (mr *MockScheduleServiceMockRecorder) PauseSchedule(id, paused interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartUploadingTask", reflect.TypeOf((*MockTaskService)(nil).StartUploadingTask), sellerId, xlsxURL)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PauseSchedule", reflect.TypeOf((*MockScheduleService)(nil).PauseSchedule), id, paused)
 }
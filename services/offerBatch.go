@@ -0,0 +1,104 @@
+package services
+
+import (
+	"MartellX/avito-tech-task/models"
+	"MartellX/avito-tech-task/repositories"
+)
+
+// offerBatch копит строки таблицы и записывает их пачками через UpsertOffers и DeleteOffers
+// вместо FindOffer и отдельного запроса на каждую строку
+type offerBatch struct {
+	size     int
+	sellerId uint64
+	state    *taskState
+	repo     repositories.Repository
+
+	upserts    []models.Offer
+	upsertRows []RowData
+	deletes    []uint64
+	deleteRows []RowData
+	// offer_id в текущей пачке: один товар не может попасть в запрос дважды
+	pending map[uint64]struct{}
+	// Лист, из которого строки пачки. Пачка не смешивает листы, чтобы счетчики листов были точными
+	sheet string
+}
+
+func newOfferBatch(size int, state *taskState, repo repositories.Repository) *offerBatch {
+	return &offerBatch{
+		size:     size,
+		sellerId: state.sellerId(),
+		state:    state,
+		repo:     repo,
+		pending:  map[uint64]struct{}{},
+	}
+}
+
+// add добавляет строку в пачку. Если пачка заполнена, товар в ней уже есть или строка с другого листа,
+// сначала записывает пачку. Строка добавляется, даже если запись предыдущей пачки не удалась
+func (b *offerBatch) add(row RowData) (err error) {
+	_, ok := b.pending[row.Columns.OfferId]
+	if ok || len(b.pending) >= b.size || (len(b.pending) > 0 && row.Sheet != b.sheet) {
+		err = b.flush()
+	}
+
+	b.sheet = row.Sheet
+	b.pending[row.Columns.OfferId] = struct{}{}
+	if row.Columns.Available {
+		b.upserts = append(b.upserts, models.Offer{
+			OfferId:   row.Columns.OfferId,
+			SellerId:  b.sellerId,
+			Name:      row.Columns.Name,
+			Price:     row.Columns.Price,
+			Quantity:  row.Columns.Quantity,
+			Available: row.Columns.Available,
+		})
+		b.upsertRows = append(b.upsertRows, row)
+	} else {
+		b.deletes = append(b.deletes, row.Columns.OfferId)
+		b.deleteRows = append(b.deleteRows, row)
+	}
+	return err
+}
+
+// flush записывает накопленные строки. Если запрос не удался, ошибка записывается для каждой его строки
+func (b *offerBatch) flush() error {
+	defer b.reset()
+
+	var firstErr error
+	if len(b.upserts) > 0 {
+		created, updated, err := b.repo.UpsertOffers(b.sellerId, b.upserts)
+		if err != nil {
+			b.fail(b.upsertRows, err)
+			firstErr = err
+		} else {
+			b.state.addCounts(b.sheet, created, updated, 0)
+		}
+	}
+
+	if len(b.deletes) > 0 {
+		deleted, err := b.repo.DeleteOffers(b.sellerId, b.deletes)
+		if err != nil {
+			b.fail(b.deleteRows, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			b.state.addCounts(b.sheet, 0, 0, int(deleted))
+		}
+	}
+	return firstErr
+}
+
+func (b *offerBatch) fail(rows []RowData, err error) {
+	for _, row := range rows {
+		b.state.addRowError(dbFailure(row, err))
+	}
+}
+
+func (b *offerBatch) reset() {
+	b.upserts = nil
+	b.upsertRows = nil
+	b.deletes = nil
+	b.deleteRows = nil
+	b.pending = map[uint64]struct{}{}
+}
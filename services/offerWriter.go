@@ -0,0 +1,63 @@
+package services
+
+import (
+	"MartellX/avito-tech-task/models"
+	"MartellX/avito-tech-task/repositories"
+)
+
+// offerWriter применяет решения, принятые по строкам таблицы
+type offerWriter interface {
+	create(sellerId uint64, row RowData) error
+	update(offer *models.Offer, row RowData) error
+	delete(offer *models.Offer) error
+}
+
+// repoWriter записывает изменения в репозиторий
+type repoWriter struct {
+	repo repositories.Repository
+}
+
+func (w repoWriter) create(sellerId uint64, row RowData) error {
+	_, err := w.repo.NewOffer(row.Columns.OfferId, sellerId, row.Columns.Name, row.Columns.Price, row.Columns.Quantity, row.Columns.Available)
+	return err
+}
+
+func (w repoWriter) update(offer *models.Offer, row RowData) error {
+	return w.repo.UpdateColumns(offer, row.Columns.Name, row.Columns.Price, row.Columns.Quantity, row.Columns.Available)
+}
+
+func (w repoWriter) delete(offer *models.Offer) error {
+	return w.repo.Delete(offer)
+}
+
+// previewWriter ничего не меняет в базе, а только запоминает, что было бы сделано
+type previewWriter struct {
+	preview *models.TaskPreview
+}
+
+func (w previewWriter) create(sellerId uint64, row RowData) error {
+	w.preview.Created = append(w.preview.Created, models.Offer{
+		OfferId:   row.Columns.OfferId,
+		SellerId:  sellerId,
+		Name:      row.Columns.Name,
+		Price:     row.Columns.Price,
+		Quantity:  row.Columns.Quantity,
+		Available: row.Columns.Available,
+	})
+	return nil
+}
+
+func (w previewWriter) update(offer *models.Offer, row RowData) error {
+	updated := *offer
+	updated.Name = row.Columns.Name
+	updated.Price = row.Columns.Price
+	updated.Quantity = row.Columns.Quantity
+	updated.Available = row.Columns.Available
+	w.preview.Updated = append(w.preview.Updated, updated)
+	return nil
+}
+
+func (w previewWriter) delete(offer *models.Offer) error {
+	w.preview.Deleted = append(w.preview.Deleted, *offer)
+	return nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var ErrQueueFull = errors.New("task queue is full")
+
+type job struct {
+	state *taskState
+	run   func(state *taskState)
+}
+
+// enqueueTask создает задание и ставит его в очередь, не блокируясь.
+// Если очередь заполнена, задание не создается и возвращается ErrQueueFull.
+// Если у продавца уже есть задание с тем же ключом идемпотентности, возвращается оно с пометкой Replayed, а enqueued равен false
+func (s *TaskServiceImpl) enqueueTask(task Task, opts TaskOptions, run func(state *taskState)) (created *Task, enqueued bool, err error) {
+	s.enqueueMu.Lock()
+	defer s.enqueueMu.Unlock()
+
+	// Проверка под enqueueMu: два одновременных запроса с одним ключом не создадут два задания,
+	// а добавляют в канал только под enqueueMu, поэтому после проверки отправка не заблокируется
+	if existing, err := s.checkNewTask(task.SellerId, opts.IdempotencyKey); err != nil || existing != nil {
+		return existing, false, err
+	}
+
+	state, err := s.createTask(task, opts, s.enqueued+1)
+	if err != nil {
+		return nil, false, err
+	}
+	s.enqueued++
+	s.jobs <- job{state: state, run: run}
+	return s.snapshot(state), true, nil
+}
+
+// CheckNewTask проверяет до приема файла, создаст ли запрос новое задание: возвращает уже созданное задание
+// продавца с ключом идемпотентности key или ErrQueueFull, если очередь заполнена. При постановке в очередь
+// проверка повторяется, поэтому ее результат - только подсказка, чтобы не принимать файл зря
+func (s *TaskServiceImpl) CheckNewTask(sellerId uint64, key string) (*Task, error) {
+	s.enqueueMu.Lock()
+	defer s.enqueueMu.Unlock()
+	return s.checkNewTask(sellerId, key)
+}
+
+// checkNewTask вызывается под enqueueMu
+func (s *TaskServiceImpl) checkNewTask(sellerId uint64, key string) (*Task, error) {
+	if key != "" {
+		existing, err := s.findIdempotentTask(sellerId, key)
+		if err != nil || existing != nil {
+			if existing != nil {
+				existing.Replayed = true
+			}
+			return existing, err
+		}
+	}
+	if len(s.jobs) >= cap(s.jobs) {
+		return nil, ErrQueueFull
+	}
+	return nil, nil
+}
+
+func (s *TaskServiceImpl) startWorkers(n int) {
+	for i := 0; i < n; i++ {
+		go s.worker()
+	}
+}
+
+func (s *TaskServiceImpl) worker() {
+	for j := range s.jobs {
+		atomic.AddUint64(&s.dequeued, 1)
+		j.run(j.state)
+	}
+}
+
+// queuePosition возвращает позицию задания в очереди, начиная с 1
+func (s *TaskServiceImpl) queuePosition(state *taskState) int {
+	position := int64(state.queueSeq) - int64(atomic.LoadUint64(&s.dequeued))
+	if position < 1 {
+		return 0
+	}
+	return int(position)
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"MartellX/avito-tech-task/models"
+	"github.com/tealeg/xlsx"
+)
+
+// GetTaskErrors возвращает ошибки строк задания и их общее количество.
+// При limit <= 0 возвращаются все ошибки
+func (s *TaskServiceImpl) GetTaskErrors(id string, limit, offset int) ([]models.TaskRowError, int64, error) {
+	if _, ok := s.GetTask(id); !ok {
+		return nil, 0, ErrTaskNotFound
+	}
+	return s.repo.FindTaskRowErrors(id, limit, offset)
+}
+
+// BuildErrorsReport формирует xlsx-отчет, в котором каждой ошибочной строке
+// соответствует ее номер в исходной таблице, колонка, значение и причина ошибки
+func BuildErrorsReport(rowErrors []models.TaskRowError) (*xlsx.File, error) {
+	file := xlsx.NewFile()
+	sheet, err := file.AddSheet("errors")
+	if err != nil {
+		return nil, err
+	}
+
+	sheet.AddRow().WriteSlice(&[]string{"row", "column", "value", "reason", "message", "sheet"}, -1)
+	for _, rowError := range rowErrors {
+		row := sheet.AddRow()
+		row.AddCell().SetInt(rowError.Row)
+		row.AddCell().SetString(rowError.Column)
+		row.AddCell().SetString(rowError.Value)
+		row.AddCell().SetString(rowError.Reason)
+		row.AddCell().SetString(rowError.Message)
+		row.AddCell().SetString(rowError.Sheet)
+	}
+	return file, nil
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"MartellX/avito-tech-task/models"
+	"MartellX/avito-tech-task/repositories"
+	"github.com/gofrs/uuid"
+	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// Scheduler хранит расписания импорта в базе и по ним ставит задания в очередь TaskService.
+// Расписания проверяются раз в interval, поэтому срабатывание может запоздать на interval.
+// Пропущенные, пока сервис не работал, срабатывания выполняются один раз при запуске
+type Scheduler struct {
+	repo     repositories.Repository
+	tasks    TaskService
+	interval time.Duration
+
+	// Запуск по расписанию не пересекается с его изменением, иначе удаленное расписание сохранилось бы снова
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewScheduler(repo repositories.Repository, tasks TaskService, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = DefaultConfig().SchedulePollInterval
+	}
+	return &Scheduler{repo: repo, tasks: tasks, interval: interval}
+}
+
+// Start запускает проверку расписаний в отдельной горутине
+func (s *Scheduler) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			s.RunDueSchedules(time.Now())
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop останавливает проверку расписаний и дожидается текущей
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+// RunDueSchedules ставит в очередь задания по расписаниям, время которых наступило к now,
+// и возвращает количество созданных заданий
+func (s *Scheduler) RunDueSchedules(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules, err := s.repo.FindDueSchedules(now)
+	if err != nil {
+		log.Error(err)
+		return 0
+	}
+
+	started := 0
+	for i := range schedules {
+		schedule := &schedules[i]
+		runAt := now
+		schedule.LastRunAt = &runAt
+		if cron, err := ParseCron(schedule.Cron); err != nil {
+			// Выражение проверяется при создании, сюда попадает только испорченное в базе
+			schedule.Paused = true
+			schedule.LastError = err.Error()
+		} else {
+			next := cron.Next(now)
+			schedule.NextRunAt = &next
+
+			task, err := s.tasks.StartUploadingTask(schedule.SellerId, schedule.URL, TaskOptions{ScheduleId: schedule.Id})
+			if err != nil {
+				schedule.LastError = err.Error()
+			} else {
+				schedule.LastTaskId = task.Id
+				schedule.LastError = ""
+				started++
+			}
+		}
+		if err := s.repo.SaveSchedule(schedule); err != nil {
+			log.Error(err)
+		}
+	}
+	return started
+}
+
+// CreateSchedule сохраняет расписание импорта таблицы продавца по ссылке url.
+// Первое срабатывание - ближайшее по выражению cron после текущего момента
+func (s *Scheduler) CreateSchedule(sellerId uint64, url, cron string) (*models.Schedule, error) {
+	expr, err := ParseCron(cron)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduleUUID, _ := uuid.DefaultGenerator.NewV4()
+	next := expr.Next(time.Now())
+	schedule := &models.Schedule{
+		Id:        scheduleUUID.String(),
+		SellerId:  sellerId,
+		URL:       url,
+		Cron:      cron,
+		NextRunAt: &next,
+	}
+	if err := s.repo.CreateSchedule(schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func (s *Scheduler) GetSchedules(sellerId uint64) ([]models.Schedule, error) {
+	return s.repo.FindSchedules(sellerId)
+}
+
+// PauseSchedule приостанавливает или возобновляет расписание.
+// Возобновленное расписание срабатывает в ближайшее по выражению время, пропущенные срабатывания не выполняются
+func (s *Scheduler) PauseSchedule(id string, paused bool) (*models.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, err := s.findSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Paused == paused {
+		return schedule, nil
+	}
+	if !paused {
+		cron, err := ParseCron(schedule.Cron)
+		if err != nil {
+			return nil, err
+		}
+		next := cron.Next(time.Now())
+		schedule.NextRunAt = &next
+	}
+	schedule.Paused = paused
+	if err := s.repo.SaveSchedule(schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// DeleteSchedule удаляет расписание. Уже созданные по нему задания не отменяются
+func (s *Scheduler) DeleteSchedule(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, err := s.repo.DeleteSchedule(id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+// GetScheduleTasks возвращает задания, созданные по расписанию, начиная с последнего
+func (s *Scheduler) GetScheduleTasks(id string, limit, offset int) ([]models.Task, int64, error) {
+	if _, err := s.findSchedule(id); err != nil {
+		return nil, 0, err
+	}
+	tasks, total, err := s.repo.FindScheduleTasks(id, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	now := time.Now()
+	for i := range tasks {
+		tasks[i].ComputeProgress(now)
+	}
+	return tasks, total, nil
+}
+
+func (s *Scheduler) findSchedule(id string) (*models.Schedule, error) {
+	schedule, err := s.repo.FindSchedule(id)
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrScheduleNotFound
+	}
+	return schedule, err
+}
@@ -1,6 +1,95 @@
 package services
 
+import (
+	"MartellX/avito-tech-task/models"
+	"errors"
+)
+
+var (
+	ErrTaskNotFound = errors.New("task not found")
+	ErrTaskFinished = errors.New("task is already finished")
+
+	ErrScheduleNotFound = errors.New("schedule not found")
+)
+
+// Режимы импорта
+const (
+	// Товары, которых нет в таблице, остаются без изменений
+	ModeMerge = "merge"
+	// Товары продавца, которых нет в таблице, удаляются
+	ModeFullSync = "full_sync"
+)
+
+// Форматы таблиц
+const (
+	FormatXLSX = "xlsx"
+	FormatCSV  = "csv"
+	FormatTSV  = "tsv"
+	// JSON-массив объектов с полями offer_id, name, price, quantity, available или те же объекты по одному на строку
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+// Выбор всех листов книги в TaskOptions.Sheet
+const AllSheets = "*"
+
+// Кодировки CSV и TSV
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingWindows1251 = "windows-1251"
+)
+
+type TaskOptions struct {
+	// Пробный запуск: изменения только подсчитываются и возвращаются в задании, в базу ничего не пишется
+	DryRun bool
+	// Атомарный импорт: все изменения выполняются в одной транзакции и откатываются,
+	// если запись строки в базу не удалась или доля ошибочных строк больше MaxErrorRatio
+	Atomic        bool
+	MaxErrorRatio float64
+	// ModeMerge (по умолчанию) или ModeFullSync
+	Mode string
+
+	// Формат таблицы. Если не задан, определяется по Content-Type, расширению в ссылке и содержимому файла
+	Format string
+	// Параметры CSV и TSV. Разделитель полей по умолчанию определяется по заголовку,
+	// кодировка по умолчанию EncodingUTF8, разделитель дробной части - точка
+	Delimiter        rune
+	Encoding         string
+	DecimalSeparator rune
+
+	// Явное сопоставление колонок товара (offer_id, name, price, quantity, available) с названиями колонок
+	// в заголовке таблицы или их номерами, начиная с 1. Для JSON-фида - с названиями полей.
+	// Остальные колонки находятся по известным названиям на русском и английском
+	Columns map[string]string
+
+	// Лист книги xlsx: имя, номер начиная с 1 или AllSheets. По умолчанию импортируется первый лист.
+	// У каждого листа свой заголовок, ошибки строк указывают лист, а при AllSheets в задании есть счетчики по листам
+	Sheet string
+
+	// Повторить импорт, даже если продавец уже импортировал такой же файл с теми же параметрами
+	Force bool
+	// Ключ идемпотентности: повторный запрос продавца с тем же ключом возвращает уже созданное задание
+	IdempotencyKey string
+	// Адрес, на который отправляется задание после завершения
+	CallbackURL string
+	// Расписание, по которому создается задание
+	ScheduleId string
+}
+
 type TaskService interface {
 	GetTask(id string) (*Task, bool)
-	StartUploadingTask(sellerId uint64, xlsxURL string) (task *Task, err error)
+	StartUploadingTask(sellerId uint64, xlsxURL string, opts TaskOptions) (task *Task, err error)
+	StartUploadingFileTask(sellerId uint64, upload UploadedFile, opts TaskOptions) (*Task, error)
+	CheckNewTask(sellerId uint64, idempotencyKey string) (*Task, error)
+	CancelTask(id string) (*Task, error)
+	GetTaskErrors(id string, limit, offset int) ([]models.TaskRowError, int64, error)
+	SubscribeTask(id string) (events <-chan TaskEvent, unsubscribe func(), err error)
+}
+
+type ScheduleService interface {
+	CreateSchedule(sellerId uint64, url, cron string) (*models.Schedule, error)
+	GetSchedules(sellerId uint64) ([]models.Schedule, error)
+	PauseSchedule(id string, paused bool) (*models.Schedule, error)
+	DeleteSchedule(id string) error
+	GetScheduleTasks(id string, limit, offset int) ([]models.Task, int64, error)
 }
@@ -2,19 +2,41 @@ package services_test
 
 import (
 	"MartellX/avito-tech-task/models"
+	"MartellX/avito-tech-task/repositories"
 	mocks "MartellX/avito-tech-task/repositories/mock_repositories"
 	"MartellX/avito-tech-task/services"
+	"MartellX/avito-tech-task/services/mock_services"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
 	. "github.com/onsi/gomega"
+	"github.com/tealeg/xlsx"
 	"gorm.io/gorm"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+var testdataServerOnce sync.Once
+
 func startTestdataServer() {
+	testdataServerOnce.Do(func() {
+		go serveTestdata()
+		time.Sleep(5 * time.Millisecond)
+	})
+}
+
+func serveTestdata() {
 	e := echo.New()
 
 	e.Use(middleware.Logger())
@@ -22,14 +44,118 @@ func startTestdataServer() {
 	e.File("/testdata2", "./testdata/testdata2.xlsx")
 	e.File("/testdata3", "./testdata/testdata3.xlsx")
 	e.File("/testdata4", "./testdata/testdata4.xlsx")
+	e.File("/testdata5.csv", "./testdata/testdata5.csv")
+	e.File("/testdata6.tsv", "./testdata/testdata6.tsv")
+	e.File("/testdata7.json", "./testdata/testdata7.json")
+	e.File("/testdata8.ndjson", "./testdata/testdata8.ndjson")
 	e.File("/emptydata", "./testdata/emptydata.xlsx")
 	e.File("/badfile", "./testdata/badfile")
 	e.Logger.Fatal(e.Start(":1234"))
 }
 
+// expectTaskStorage подменяет хранение заданий в репозитории простым map
+func expectTaskStorage(repo *mocks.MockRepository) {
+	var mu sync.Mutex
+	tasks := map[string]models.Task{}
+	// Порядок создания заданий вместо created_at
+	var created []string
+	save := func(t *models.Task) error {
+		mu.Lock()
+		defer mu.Unlock()
+		saved := *t
+		// Как в базе: пометку Stale задание не затирает
+		saved.Stale = tasks[t.Id].Stale
+		tasks[t.Id] = saved
+		return nil
+	}
+	repo.EXPECT().CreateTask(gomock.Any()).DoAndReturn(func(t *models.Task) error {
+		mu.Lock()
+		created = append(created, t.Id)
+		mu.Unlock()
+		return save(t)
+	}).AnyTimes()
+	repo.EXPECT().SaveTask(gomock.Any()).DoAndReturn(save).AnyTimes()
+	repo.EXPECT().FindLastImportTask(gomock.Any(), gomock.Any()).DoAndReturn(func(sellerId uint64, excludeId string) (*models.Task, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for i := len(created) - 1; i >= 0; i-- {
+			t := tasks[created[i]]
+			if t.SellerId == sellerId && !t.DryRun && t.Id != excludeId {
+				return &t, nil
+			}
+		}
+		return nil, gorm.ErrRecordNotFound
+	}).AnyTimes()
+	repo.EXPECT().MarkImportsStale(gomock.Any()).DoAndReturn(func(sellerId uint64) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for id, t := range tasks {
+			if t.SellerId == sellerId {
+				t.Stale = true
+				tasks[id] = t
+			}
+		}
+		return nil
+	}).AnyTimes()
+	repo.EXPECT().FindTaskByIdempotencyKey(gomock.Any(), gomock.Any()).DoAndReturn(func(sellerId uint64, key string) (*models.Task, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, t := range tasks {
+			if t.SellerId == sellerId && t.IdempotencyKey == key {
+				return &t, nil
+			}
+		}
+		return nil, gorm.ErrRecordNotFound
+	}).AnyTimes()
+	repo.EXPECT().FindTask(gomock.Any()).DoAndReturn(func(id string) (*models.Task, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		t, ok := tasks[id]
+		if !ok {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return &t, nil
+	}).AnyTimes()
+
+	rowErrors := map[string][]models.TaskRowError{}
+	repo.EXPECT().CreateTaskRowErrors(gomock.Any()).DoAndReturn(func(errs []models.TaskRowError) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, e := range errs {
+			rowErrors[e.TaskId] = append(rowErrors[e.TaskId], e)
+		}
+		return nil
+	}).AnyTimes()
+	repo.EXPECT().FindTaskRowErrors(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(taskId string, limit, offset int) ([]models.TaskRowError, int64, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs := rowErrors[taskId]
+			total := int64(len(errs))
+			if offset > len(errs) {
+				offset = len(errs)
+			}
+			errs = errs[offset:]
+			if limit > 0 && limit < len(errs) {
+				errs = errs[:limit]
+			}
+			return errs, total, nil
+		}).AnyTimes()
+}
+
+// waitTask опрашивает сервис, пока задание не завершится
+func waitTask(service services.TaskService, id string) *services.Task {
+	for {
+		task, ok := service.GetTask(id)
+		if ok && task.IsFinished() {
+			return task
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
 func TestService_StartUploadingTask(t *testing.T) {
-	go startTestdataServer()
-	time.Sleep(5 * time.Millisecond)
+	startTestdataServer()
 
 	mockCtrl := gomock.NewController(t)
 	g := NewWithT(t)
@@ -50,10 +176,6 @@ func TestService_StartUploadingTask(t *testing.T) {
 				repo.EXPECT().NewOffer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
 			},
 			result: func(task *services.Task) {
-				g.Expect(task.StatusCode).ShouldNot(And(Equal(404), Equal(400)))
-				for task.StatusCode == 201 || task.StatusCode == 102 {
-					time.Sleep(5 * time.Millisecond)
-				}
 				g.Expect(task.StatusCode).ShouldNot(And(Equal(404), Equal(400)))
 				g.Expect(task.Info.Created).Should(Equal(9))
 			},
@@ -67,10 +189,6 @@ func TestService_StartUploadingTask(t *testing.T) {
 				repo.EXPECT().UpdateColumns(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).MaxTimes(9)
 			},
 			result: func(task *services.Task) {
-				g.Expect(task.StatusCode).ShouldNot(And(Equal(404), Equal(400)))
-				for task.StatusCode == 201 || task.StatusCode == 102 {
-					time.Sleep(5 * time.Millisecond)
-				}
 				g.Expect(task.StatusCode).ShouldNot(And(Equal(404), Equal(400)))
 				g.Expect(task.Info.Updated).Should(Equal(9))
 			},
@@ -88,10 +206,6 @@ func TestService_StartUploadingTask(t *testing.T) {
 				repo.EXPECT().Delete(gomock.AssignableToTypeOf(&models.Offer{})).MaxTimes(8)
 			},
 			result: func(task *services.Task) {
-				g.Expect(task.StatusCode).ShouldNot(And(Equal(404), Equal(400)))
-				for task.StatusCode == 201 || task.StatusCode == 102 {
-					time.Sleep(5 * time.Millisecond)
-				}
 				g.Expect(task.StatusCode).ShouldNot(And(Equal(404), Equal(400)))
 				g.Expect(task.Info.Deleted).Should(Equal(8))
 			},
@@ -104,10 +218,6 @@ func TestService_StartUploadingTask(t *testing.T) {
 
 			},
 			result: func(task *services.Task) {
-				g.Expect(task.StatusCode).ShouldNot(And(Equal(404), Equal(400)))
-				for task.StatusCode == 201 || task.StatusCode == 102 {
-					time.Sleep(5 * time.Millisecond)
-				}
 				g.Expect(task.StatusCode).ShouldNot(And(Equal(404), Equal(400)))
 				g.Expect(task.Info.Errors).Should(Equal(6))
 			},
@@ -130,10 +240,6 @@ func TestService_StartUploadingTask(t *testing.T) {
 
 			},
 			result: func(task *services.Task) {
-				g.Expect(task.StatusCode).ShouldNot(And(Equal(404), Equal(400)))
-				for task.StatusCode == 201 || task.StatusCode == 102 {
-					time.Sleep(5 * time.Millisecond)
-				}
 				g.Expect(task.StatusCode).ShouldNot(And(Equal(404), Equal(400)))
 				g.Expect(task.Info.Created).Should(Equal(3))
 				g.Expect(task.Info.Updated).Should(Equal(3))
@@ -141,6 +247,21 @@ func TestService_StartUploadingTask(t *testing.T) {
 				g.Expect(task.Info.Errors).Should(Equal(5))
 			},
 		},
+		{
+			description: "failed deletes are row errors, not deleted offers",
+			url:         "http://localhost:1234/testdata4",
+			sellerId:    123,
+			expect: func(repo *mocks.MockRepository) {
+				repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(&models.Offer{}, nil).Times(9)
+				repo.EXPECT().UpdateColumns(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(6)
+				repo.EXPECT().Delete(gomock.AssignableToTypeOf(&models.Offer{})).Return(errors.New("connection refused")).Times(3)
+			},
+			result: func(task *services.Task) {
+				g.Expect(task.Info.Updated).Should(Equal(6))
+				g.Expect(task.Info.Deleted).Should(Equal(0))
+				g.Expect(task.Info.Errors).Should(Equal(8))
+			},
+		},
 		{
 			description: "Empty table",
 			url:         "http://localhost:1234/emptydata",
@@ -149,9 +270,6 @@ func TestService_StartUploadingTask(t *testing.T) {
 
 			},
 			result: func(task *services.Task) {
-				for task.StatusCode == 201 || task.StatusCode == 102 {
-					time.Sleep(5 * time.Millisecond)
-				}
 				g.Expect(task.StatusCode).Should(Equal(400))
 			},
 		},
@@ -164,9 +282,6 @@ func TestService_StartUploadingTask(t *testing.T) {
 
 			},
 			result: func(task *services.Task) {
-				for task.StatusCode == 201 || task.StatusCode == 102 {
-					time.Sleep(5 * time.Millisecond)
-				}
 				g.Expect(task.StatusCode).Should(Equal(400))
 			},
 		},
@@ -178,9 +293,6 @@ func TestService_StartUploadingTask(t *testing.T) {
 
 			},
 			result: func(task *services.Task) {
-				for task.StatusCode == 201 || task.StatusCode == 102 {
-					time.Sleep(5 * time.Millisecond)
-				}
 				g.Expect(task.StatusCode).Should(Equal(400))
 			},
 		},
@@ -192,9 +304,6 @@ func TestService_StartUploadingTask(t *testing.T) {
 
 			},
 			result: func(task *services.Task) {
-				for task.StatusCode == 201 || task.StatusCode == 102 {
-					time.Sleep(5 * time.Millisecond)
-				}
 				g.Expect(task.StatusCode).Should(Equal(400))
 			},
 		},
@@ -206,9 +315,6 @@ func TestService_StartUploadingTask(t *testing.T) {
 
 			},
 			result: func(task *services.Task) {
-				for task.StatusCode == 201 || task.StatusCode == 102 {
-					time.Sleep(5 * time.Millisecond)
-				}
 				g.Expect(task.StatusCode).Should(Equal(400))
 			},
 		},
@@ -217,10 +323,1813 @@ func TestService_StartUploadingTask(t *testing.T) {
 	for _, c := range cases {
 		repo := mocks.NewMockRepository(mockCtrl)
 		c.expect(repo)
+		expectTaskStorage(repo)
+		service := services.NewService(repo)
+		fmt.Println(c.description)
+		task, err := service.StartUploadingTask(c.sellerId, c.url, services.TaskOptions{})
+		g.Expect(err).ShouldNot(HaveOccurred())
+		g.Expect(task.StatusCode).Should(Equal(http.StatusAccepted))
+		c.result(waitTask(service, task.Id))
+	}
+}
+
+func TestService_GetTask(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	service := services.NewService(repo)
+
+	task, err := service.StartUploadingTask(1, "aff", services.TaskOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	stored, ok := service.GetTask(task.Id)
+	g.Expect(ok).Should(BeTrue())
+	g.Expect(stored.Id).Should(Equal(task.Id))
+	g.Expect(stored.URL).Should(Equal("aff"))
+
+	_, ok = service.GetTask("unknown")
+	g.Expect(ok).Should(BeFalse())
+}
+
+func TestService_TaskProgress(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).AnyTimes()
+	service := services.NewService(repo)
+
+	task, err := service.StartUploadingTask(123, "http://localhost:1234/testdata1", services.TaskOptions{DryRun: true})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	task = waitTask(service, task.Id)
+
+	g.Expect(task.TotalRows).Should(Equal(9))
+	g.Expect(task.ProcessedRows).Should(Equal(9))
+	g.Expect(task.Progress).Should(BeEquivalentTo(100))
+	g.Expect(task.EtaSeconds).Should(BeZero())
+	g.Expect(task.StartedAt).ShouldNot(BeNil())
+	g.Expect(task.FinishedAt).ShouldNot(BeNil())
+	g.Expect(task.FinishedAt.Before(*task.StartedAt)).Should(BeFalse())
+}
+
+func TestTask_ComputeProgress(t *testing.T) {
+	g := NewWithT(t)
+
+	started := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	task := &models.Task{StatusCode: http.StatusProcessing, TotalRows: 1000, ProcessedRows: 250, StartedAt: &started}
+	task.ComputeProgress(started.Add(10 * time.Second))
+	g.Expect(task.Progress).Should(BeEquivalentTo(25))
+	g.Expect(task.RowsPerSecond).Should(BeEquivalentTo(25))
+	g.Expect(task.EtaSeconds).Should(Equal(30))
+
+	finished := started.Add(20 * time.Second)
+	task.StatusCode, task.ProcessedRows, task.FinishedAt = http.StatusOK, 1000, &finished
+	task.ComputeProgress(started.Add(time.Hour))
+	g.Expect(task.Progress).Should(BeEquivalentTo(100))
+	g.Expect(task.RowsPerSecond).Should(BeEquivalentTo(50))
+	g.Expect(task.EtaSeconds).Should(BeZero())
+
+	queued := &models.Task{StatusCode: http.StatusAccepted}
+	queued.ComputeProgress(started)
+	g.Expect(queued.Progress).Should(BeZero())
+	g.Expect(queued.EtaSeconds).Should(BeZero())
+}
+
+func TestService_InterruptUnfinishedTasks(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	repo.EXPECT().UpdateTasksStatus(models.UnfinishedTaskCodes, models.TaskStatusInterrupted, http.StatusInternalServerError).
+		Return(int64(2), nil)
+	service := services.NewService(repo)
+
+	n, err := service.InterruptUnfinishedTasks()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(n).Should(BeEquivalentTo(2))
+}
+
+func TestService_ParallelUploadsAndPolling(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).AnyTimes()
+	repo.EXPECT().NewOffer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	expectTaskStorage(repo)
+	service := services.NewService(repo)
+
+	const tasksCount = 8
+	var wg sync.WaitGroup
+	for i := 0; i < tasksCount; i++ {
+		wg.Add(1)
+		go func(sellerId uint64) {
+			defer wg.Done()
+			task, err := service.StartUploadingTask(sellerId, "http://localhost:1234/testdata1", services.TaskOptions{})
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			task = waitTask(service, task.Id)
+			g.Expect(task.Status).Should(Equal(models.TaskStatusCompleted))
+			g.Expect(task.Info.Created).Should(Equal(9))
+		}(uint64(i))
+	}
+	wg.Wait()
+}
+
+func TestService_Queue(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	// Сервер держит скачивание, пока не закроют release, чтобы единственный воркер был занят
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	service := services.NewServiceWithConfig(repo, services.Config{Workers: 1, QueueSize: 2})
+
+	running, err := service.StartUploadingTask(1, server.URL, services.TaskOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Eventually(func() string {
+		task, _ := service.GetTask(running.Id)
+		return task.Status
+	}).Should(Equal(models.TaskStatusDownloading))
+
+	first, err := service.StartUploadingTask(1, server.URL, services.TaskOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(first.Status).Should(Equal(models.TaskStatusQueued))
+	g.Expect(first.QueuePosition).Should(Equal(1))
+
+	existing, err := service.CheckNewTask(1, "")
+	g.Expect(existing).Should(BeNil())
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	second, err := service.StartUploadingTask(1, server.URL, services.TaskOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(second.QueuePosition).Should(Equal(2))
+
+	_, err = service.StartUploadingTask(1, server.URL, services.TaskOptions{})
+	g.Expect(err).Should(Equal(services.ErrQueueFull))
+	_, err = service.CheckNewTask(1, "")
+	g.Expect(err).Should(Equal(services.ErrQueueFull))
+
+	close(release)
+	for _, id := range []string{running.Id, first.Id, second.Id} {
+		task := waitTask(service, id)
+		g.Expect(task.QueuePosition).Should(BeZero())
+	}
+}
+
+func TestService_CancelTask(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	// Выполняющееся задание останавливается на следующей строке и сохраняет счетчики
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	service := services.NewService(repo)
+
+	var taskId string
+	var calls int
+	repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).DoAndReturn(func(offerId, sellerId uint64) (*models.Offer, error) {
+		calls++
+		if calls == 3 {
+			_, err := service.CancelTask(taskId)
+			g.Expect(err).ShouldNot(HaveOccurred())
+		}
+		return nil, gorm.ErrRecordNotFound
+	}).Times(3)
+	repo.EXPECT().NewOffer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).Times(3)
+
+	task, err := service.StartUploadingTask(1, "http://localhost:1234/testdata1", services.TaskOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	taskId = task.Id
+
+	task = waitTask(service, task.Id)
+	g.Expect(task.Status).Should(Equal(models.TaskStatusCancelled))
+	g.Expect(task.StatusCode).Should(Equal(models.StatusClientClosedRequest))
+	g.Expect(task.Info.Created).Should(Equal(3))
+
+	_, err = service.CancelTask(task.Id)
+	g.Expect(err).Should(Equal(services.ErrTaskFinished))
+	_, err = service.CancelTask("unknown")
+	g.Expect(err).Should(Equal(services.ErrTaskNotFound))
+
+	// Задание в очереди отменяется сразу и не запускается
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	repo = mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	service = services.NewServiceWithConfig(repo, services.Config{Workers: 1, QueueSize: 1})
+
+	running, err := service.StartUploadingTask(1, server.URL, services.TaskOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Eventually(func() string {
+		task, _ := service.GetTask(running.Id)
+		return task.Status
+	}).Should(Equal(models.TaskStatusDownloading))
+
+	queued, err := service.StartUploadingTask(1, server.URL, services.TaskOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	cancelled, err := service.CancelTask(queued.Id)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(cancelled.Status).Should(Equal(models.TaskStatusCancelled))
+
+	close(release)
+	g.Expect(waitTask(service, running.Id).StatusCode).Should(Equal(http.StatusBadRequest))
+	g.Expect(waitTask(service, queued.Id).Status).Should(Equal(models.TaskStatusCancelled))
+}
+
+func TestService_GetTaskErrors(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	service := services.NewService(repo)
+
+	task, err := service.StartUploadingTask(123, "http://localhost:1234/testdata2", services.TaskOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	task = waitTask(service, task.Id)
+	g.Expect(task.Info.Errors).Should(Equal(6))
+
+	rowErrors, total, err := service.GetTaskErrors(task.Id, 0, 0)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(total).Should(BeEquivalentTo(6))
+
+	type rowError struct {
+		Row    int
+		Column string
+		Value  string
+		Reason string
+	}
+	var got []rowError
+	for _, e := range rowErrors {
+		got = append(got, rowError{e.Row, e.Column, e.Value, e.Reason})
+	}
+	g.Expect(got).Should(Equal([]rowError{
+		{2, "offer_id", "a", models.RowErrorBadOfferId},
+		{3, "price", "a", models.RowErrorBadPrice},
+		{4, "quantity", "d", models.RowErrorBadQuantity},
+		{5, "available", "12", models.RowErrorBadAvailable},
+		{6, "available", "x", models.RowErrorBadAvailable},
+		{7, "offer_id", "", models.RowErrorBadOfferId},
+	}))
+
+	page, total, err := service.GetTaskErrors(task.Id, 2, 2)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(total).Should(BeEquivalentTo(6))
+	g.Expect(page).Should(Equal(rowErrors[2:4]))
+
+	report, err := services.BuildErrorsReport(rowErrors)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(report.Sheets[0].Rows).Should(HaveLen(7))
+	g.Expect(report.Sheets[0].Rows[1].Cells[3].String()).Should(Equal(models.RowErrorBadOfferId))
+
+	_, _, err = service.GetTaskErrors("unknown", 0, 0)
+	g.Expect(err).Should(Equal(services.ErrTaskNotFound))
+}
+
+func TestService_RowErrorReasons(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	gomock.InOrder(
+		repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).Times(3),
+		repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused")).Times(6),
+	)
+	repo.EXPECT().NewOffer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, errors.New("duplicate key")).Times(3)
+	service := services.NewService(repo)
+
+	task, err := service.StartUploadingTask(123, "http://localhost:1234/testdata4", services.TaskOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	task = waitTask(service, task.Id)
+	g.Expect(task.Info.Errors).Should(Equal(14))
+
+	rowErrors, _, err := service.GetTaskErrors(task.Id, 0, 0)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	reasons := map[int]string{}
+	for _, e := range rowErrors {
+		reasons[e.Row] = e.Reason
+	}
+	g.Expect(reasons).Should(HaveKeyWithValue(2, models.RowErrorDbFailure))
+	g.Expect(reasons).Should(HaveKeyWithValue(11, models.RowErrorBadOfferId))
+	g.Expect(reasons).Should(HaveKeyWithValue(12, models.RowErrorNegativePrice))
+	g.Expect(reasons).Should(HaveKeyWithValue(13, models.RowErrorNegativeQuantity))
+	g.Expect(reasons).Should(HaveKeyWithValue(14, models.RowErrorBadAvailable))
+	g.Expect(reasons).Should(HaveKeyWithValue(15, models.RowErrorBadOfferId))
+}
+
+func TestService_DryRun(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	// Обращения на запись (NewOffer, UpdateColumns, Delete) не ожидаются
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	gomock.InOrder(
+		repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).Times(3),
+		repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).DoAndReturn(func(offerId, sellerId uint64) (*models.Offer, error) {
+			return &models.Offer{OfferId: offerId, SellerId: sellerId, Name: "old", Price: 1, Quantity: 1, Available: true}, nil
+		}).Times(6),
+	)
+	service := services.NewService(repo)
+
+	task, err := service.StartUploadingTask(123, "http://localhost:1234/testdata4", services.TaskOptions{DryRun: true})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(task.DryRun).Should(BeTrue())
+
+	task = waitTask(service, task.Id)
+	g.Expect(task.Status).Should(Equal(models.TaskStatusCompleted))
+	g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: 3, Updated: 3, Deleted: 3, Errors: 5}))
+	g.Expect(task.Preview).ShouldNot(BeNil())
+	g.Expect(task.Preview.Created).Should(HaveLen(3))
+	g.Expect(task.Preview.Created[0]).Should(Equal(models.Offer{OfferId: 1, SellerId: 123, Name: "kek", Price: 67601, Quantity: 123, Available: true}))
+	g.Expect(task.Preview.Updated).Should(HaveLen(3))
+	g.Expect(task.Preview.Updated[0].Name).Should(Equal("2UXwknE7pti5USN"))
+	g.Expect(task.Preview.Deleted).Should(HaveLen(3))
+	g.Expect(task.Preview.Deleted[0].Name).Should(Equal("old"))
+	g.Expect(task.Preview.Errors).Should(HaveLen(5))
+}
+
+// expectTransaction выполняет функцию транзакции на том же моке и возвращает ее результат
+func expectTransaction(repo *mocks.MockRepository) {
+	repo.EXPECT().Transaction(gomock.Any()).DoAndReturn(func(fn func(repositories.Repository) error) error {
+		return fn(repo)
+	})
+}
+
+func TestService_AtomicImport(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	cases := []struct {
+		description string
+		url         string
+		opts        services.TaskOptions
+		expect      func(repo *mocks.MockRepository)
+		result      func(task *services.Task)
+	}{
+		{
+			description: "all rows are valid - completed in one transaction",
+			url:         "http://localhost:1234/testdata1",
+			opts:        services.TaskOptions{Atomic: true},
+			expect: func(repo *mocks.MockRepository) {
+				expectTransaction(repo)
+				repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).Times(9)
+				repo.EXPECT().NewOffer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).Times(9)
+			},
+			result: func(task *services.Task) {
+				g.Expect(task.Status).Should(Equal(models.TaskStatusCompleted))
+				g.Expect(task.Info.Created).Should(Equal(9))
+			},
+		},
+		{
+			description: "db failure - rolled back and stopped on failed row",
+			url:         "http://localhost:1234/testdata1",
+			opts:        services.TaskOptions{Atomic: true, Sheet: services.AllSheets},
+			expect: func(repo *mocks.MockRepository) {
+				expectTransaction(repo)
+				repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).Times(2)
+				gomock.InOrder(
+					repo.EXPECT().NewOffer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil),
+					repo.EXPECT().NewOffer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("duplicate key")),
+				)
+			},
+			result: func(task *services.Task) {
+				g.Expect(task.Status).Should(Equal(models.TaskStatusRolledBack))
+				g.Expect(task.StatusCode).Should(Equal(http.StatusUnprocessableEntity))
+				g.Expect(task.Info.Errors).Should(Equal(1))
+				// Первая строка была записана, но откатилась
+				g.Expect(task.Info.Created).Should(Equal(0))
+				g.Expect(task.Info.Sheets).ShouldNot(BeEmpty())
+				g.Expect(task.Info.Sheets[0].Created).Should(Equal(0))
+				g.Expect(task.Info.Sheets[0].Errors).Should(Equal(1))
+			},
+		},
+		{
+			description: "error ratio exceeds threshold - rolled back",
+			url:         "http://localhost:1234/testdata4",
+			opts:        services.TaskOptions{Atomic: true, MaxErrorRatio: 0.2},
+			expect: func(repo *mocks.MockRepository) {
+				expectTransaction(repo)
+				repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(&models.Offer{}, nil).Times(9)
+				repo.EXPECT().UpdateColumns(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(6)
+				repo.EXPECT().Delete(gomock.Any()).Times(3)
+			},
+			result: func(task *services.Task) {
+				g.Expect(task.Status).Should(Equal(models.TaskStatusRolledBack))
+				g.Expect(task.Info.Errors).Should(Equal(5))
+				g.Expect(task.Info.Updated).Should(Equal(0))
+				g.Expect(task.Info.Deleted).Should(Equal(0))
+			},
+		},
+		{
+			description: "error ratio within threshold - completed",
+			url:         "http://localhost:1234/testdata4",
+			opts:        services.TaskOptions{Atomic: true, MaxErrorRatio: 0.5},
+			expect: func(repo *mocks.MockRepository) {
+				expectTransaction(repo)
+				repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(&models.Offer{}, nil).Times(9)
+				repo.EXPECT().UpdateColumns(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(6)
+				repo.EXPECT().Delete(gomock.Any()).Times(3)
+			},
+			result: func(task *services.Task) {
+				g.Expect(task.Status).Should(Equal(models.TaskStatusCompleted))
+				g.Expect(task.Info.Errors).Should(Equal(5))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		repo := mocks.NewMockRepository(mockCtrl)
+		c.expect(repo)
+		expectTaskStorage(repo)
+		service := services.NewService(repo)
+		fmt.Println(c.description)
+		task, err := service.StartUploadingTask(123, c.url, c.opts)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		c.result(waitTask(service, task.Id))
+	}
+}
+
+func TestService_FullSync(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	// Товары продавца в базе: 86875 есть в testdata1, 1 и 2 - нет
+	sellerOffers := func() []models.Offer {
+		return []models.Offer{
+			{OfferId: 86875, SellerId: 123, Name: "kek"},
+			{OfferId: 1, SellerId: 123, Name: "missing 1"},
+			{OfferId: 2, SellerId: 123, Name: "missing 2"},
+		}
+	}
+	sellerId := uint64(123)
+
+	cases := []struct {
+		description string
+		opts        services.TaskOptions
+		expect      func(repo *mocks.MockRepository)
+		result      func(task *services.Task)
+	}{
+		{
+			description: "offers missing in file are deleted",
+			opts:        services.TaskOptions{Mode: services.ModeFullSync},
+			expect: func(repo *mocks.MockRepository) {
+				repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(&models.Offer{}, nil).Times(9)
+				repo.EXPECT().UpdateColumns(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(9)
+				repo.EXPECT().FindOffers(repositories.OfferQuery{SellerId: &sellerId}).Return(sellerOffers(), nil)
+				repo.EXPECT().Delete(&models.Offer{OfferId: 1, SellerId: 123, Name: "missing 1"})
+				repo.EXPECT().Delete(&models.Offer{OfferId: 2, SellerId: 123, Name: "missing 2"})
+			},
+			result: func(task *services.Task) {
+				g.Expect(task.Status).Should(Equal(models.TaskStatusCompleted))
+				g.Expect(task.Mode).Should(Equal(services.ModeFullSync))
+				g.Expect(task.Info.Updated).Should(Equal(9))
+				g.Expect(task.Info.Deleted).Should(Equal(2))
+			},
+		},
+		{
+			description: "dry run - offers missing in file are only reported",
+			opts:        services.TaskOptions{Mode: services.ModeFullSync, DryRun: true},
+			expect: func(repo *mocks.MockRepository) {
+				repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(&models.Offer{}, nil).Times(9)
+				repo.EXPECT().FindOffers(gomock.Any()).Return(sellerOffers(), nil)
+			},
+			result: func(task *services.Task) {
+				g.Expect(task.Info.Deleted).Should(Equal(2))
+				g.Expect(task.Preview.Deleted).Should(ConsistOf(sellerOffers()[1:]))
+			},
+		},
+		{
+			description: "atomic - offers are deleted in the same transaction",
+			opts:        services.TaskOptions{Mode: services.ModeFullSync, Atomic: true},
+			expect: func(repo *mocks.MockRepository) {
+				expectTransaction(repo)
+				repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(&models.Offer{}, nil).Times(9)
+				repo.EXPECT().UpdateColumns(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(9)
+				repo.EXPECT().FindOffers(gomock.Any()).Return(sellerOffers(), nil)
+				repo.EXPECT().Delete(gomock.Any()).Times(2)
+			},
+			result: func(task *services.Task) {
+				g.Expect(task.Status).Should(Equal(models.TaskStatusCompleted))
+				g.Expect(task.Info.Deleted).Should(Equal(2))
+			},
+		},
+		{
+			description: "atomic with rolled back rows - nothing is deleted",
+			opts:        services.TaskOptions{Mode: services.ModeFullSync, Atomic: true},
+			expect: func(repo *mocks.MockRepository) {
+				expectTransaction(repo)
+				repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused"))
+			},
+			result: func(task *services.Task) {
+				g.Expect(task.Status).Should(Equal(models.TaskStatusRolledBack))
+				g.Expect(task.Info.Deleted).Should(BeZero())
+			},
+		},
+	}
+
+	for _, c := range cases {
+		repo := mocks.NewMockRepository(mockCtrl)
+		c.expect(repo)
+		expectTaskStorage(repo)
 		service := services.NewService(repo)
 		fmt.Println(c.description)
-		task, err := service.StartUploadingTask(c.sellerId, c.url)
+		task, err := service.StartUploadingTask(123, "http://localhost:1234/testdata1", c.opts)
 		g.Expect(err).ShouldNot(HaveOccurred())
-		c.result(task)
+		c.result(waitTask(service, task.Id))
+	}
+}
+
+func TestService_BatchedUpload(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	cfg := services.DefaultConfig()
+	cfg.BatchSize = 500
+
+	// В testdata4 одни и те же offer_id повторяются, поэтому пачка записывается, как только товар встречается повторно
+	offers := func(name1, name2, name3 string) []models.Offer {
+		return []models.Offer{
+			{OfferId: 1, SellerId: 123, Name: name1, Price: 67601, Quantity: 123, Available: true},
+			{OfferId: 2, SellerId: 123, Name: name2, Price: 95074, Quantity: 790, Available: true},
+			{OfferId: 3, SellerId: 123, Name: name3, Price: 66961, Quantity: 8, Available: true},
+		}
 	}
+
+	cases := []struct {
+		description string
+		cfg         services.Config
+		opts        services.TaskOptions
+		url         string
+		expect      func(repo *mocks.MockRepository)
+		result      func(task *services.Task, rowErrors []models.TaskRowError)
+	}{
+		{
+			description: "rows are written in batches with accurate counters",
+			cfg:         cfg,
+			url:         "http://localhost:1234/testdata4",
+			expect: func(repo *mocks.MockRepository) {
+				gomock.InOrder(
+					repo.EXPECT().UpsertOffers(uint64(123), offers("kek", "W0q4DmTZOK4Kjcf", "s1y8cz4CNKRn4XG")).Return(3, 0, nil),
+					repo.EXPECT().UpsertOffers(uint64(123), gomock.Len(3)).Return(0, 3, nil),
+					repo.EXPECT().DeleteOffers(uint64(123), []uint64{1, 2, 3}).Return(int64(3), nil),
+				)
+			},
+			result: func(task *services.Task, rowErrors []models.TaskRowError) {
+				g.Expect(task.Status).Should(Equal(models.TaskStatusCompleted))
+				g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: 3, Updated: 3, Deleted: 3, Errors: 5}))
+			},
+		},
+		{
+			description: "batch size limits the number of offers per query",
+			cfg:         services.Config{Workers: 1, QueueSize: 1, BatchSize: 4},
+			url:         "http://localhost:1234/testdata1",
+			expect: func(repo *mocks.MockRepository) {
+				gomock.InOrder(
+					repo.EXPECT().UpsertOffers(uint64(123), gomock.Len(4)).Return(4, 0, nil).Times(2),
+					repo.EXPECT().UpsertOffers(uint64(123), gomock.Len(1)).Return(0, 1, nil),
+				)
+			},
+			result: func(task *services.Task, rowErrors []models.TaskRowError) {
+				g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: 8, Updated: 1}))
+			},
+		},
+		{
+			description: "failed batch - every row of the batch is reported",
+			cfg:         cfg,
+			url:         "http://localhost:1234/testdata4",
+			expect: func(repo *mocks.MockRepository) {
+				gomock.InOrder(
+					repo.EXPECT().UpsertOffers(gomock.Any(), gomock.Any()).Return(0, 0, errors.New("connection refused")),
+					repo.EXPECT().UpsertOffers(gomock.Any(), gomock.Any()).Return(0, 3, nil),
+				)
+				repo.EXPECT().DeleteOffers(gomock.Any(), gomock.Any()).Return(int64(3), nil)
+			},
+			result: func(task *services.Task, rowErrors []models.TaskRowError) {
+				g.Expect(task.Status).Should(Equal(models.TaskStatusCompleted))
+				g.Expect(task.Info).Should(Equal(models.TaskInfo{Updated: 3, Deleted: 3, Errors: 8}))
+				g.Expect(rowErrors[0]).Should(Equal(models.TaskRowError{
+					TaskId: task.Id, Row: 2, Column: "offer_id", Value: "1",
+					Reason: models.RowErrorDbFailure, Message: "connection refused",
+				}))
+			},
+		},
+		{
+			description: "atomic - failed batch rolls back the import",
+			cfg:         cfg,
+			opts:        services.TaskOptions{Atomic: true, MaxErrorRatio: 1},
+			url:         "http://localhost:1234/testdata4",
+			expect: func(repo *mocks.MockRepository) {
+				expectTransaction(repo)
+				repo.EXPECT().UpsertOffers(gomock.Any(), gomock.Any()).Return(0, 0, errors.New("connection refused"))
+			},
+			result: func(task *services.Task, rowErrors []models.TaskRowError) {
+				g.Expect(task.Status).Should(Equal(models.TaskStatusRolledBack))
+				g.Expect(rowErrors).Should(HaveLen(3))
+			},
+		},
+		{
+			description: "full sync - missing offers are deleted in batches",
+			cfg:         services.Config{Workers: 1, QueueSize: 1, BatchSize: 2},
+			opts:        services.TaskOptions{Mode: services.ModeFullSync},
+			url:         "http://localhost:1234/testdata1",
+			expect: func(repo *mocks.MockRepository) {
+				repo.EXPECT().UpsertOffers(gomock.Any(), gomock.Any()).Return(2, 0, nil).Times(4)
+				repo.EXPECT().UpsertOffers(gomock.Any(), gomock.Any()).Return(1, 0, nil)
+				repo.EXPECT().FindOffers(gomock.Any()).Return([]models.Offer{
+					{OfferId: 86875, SellerId: 123}, {OfferId: 1, SellerId: 123}, {OfferId: 2, SellerId: 123}, {OfferId: 3, SellerId: 123},
+				}, nil)
+				gomock.InOrder(
+					repo.EXPECT().DeleteOffers(uint64(123), []uint64{1, 2}).Return(int64(2), nil),
+					repo.EXPECT().DeleteOffers(uint64(123), []uint64{3}).Return(int64(1), nil),
+				)
+			},
+			result: func(task *services.Task, rowErrors []models.TaskRowError) {
+				g.Expect(task.Status).Should(Equal(models.TaskStatusCompleted))
+				g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: 9, Deleted: 3}))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		repo := mocks.NewMockRepository(mockCtrl)
+		c.expect(repo)
+		expectTaskStorage(repo)
+		service := services.NewServiceWithConfig(repo, c.cfg)
+		fmt.Println(c.description)
+		task, err := service.StartUploadingTask(123, c.url, c.opts)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		task = waitTask(service, task.Id)
+		rowErrors, _, err := service.GetTaskErrors(task.Id, 0, 0)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		c.result(task, rowErrors)
+	}
+}
+
+// Задержка ответа базы, чтобы в бенчмарке было видно, сколько запросов делает импорт
+const benchmarkRoundTrip = 200 * time.Microsecond
+
+func BenchmarkImport(b *testing.B) {
+	startTestdataServer()
+
+	roundTrip := func() { time.Sleep(benchmarkRoundTrip) }
+
+	cases := []struct {
+		name      string
+		batchSize int
+	}{
+		{"PerRow", 0},
+		{"Batched", 500},
+	}
+	for _, file := range []string{"testdata1", "testdata4"} {
+		for _, c := range cases {
+			b.Run(file+"/"+c.name, func(b *testing.B) {
+				mockCtrl := gomock.NewController(b)
+				repo := mocks.NewMockRepository(mockCtrl)
+				expectTaskStorage(repo)
+				repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).DoAndReturn(func(offerId, sellerId uint64) (*models.Offer, error) {
+					roundTrip()
+					return nil, gorm.ErrRecordNotFound
+				}).AnyTimes()
+				repo.EXPECT().NewOffer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(offerId, sellerId uint64, name string, price int64, quantity int, available bool) (*models.Offer, error) {
+						roundTrip()
+						return &models.Offer{}, nil
+					}).AnyTimes()
+				repo.EXPECT().UpsertOffers(gomock.Any(), gomock.Any()).DoAndReturn(func(sellerId uint64, offers []models.Offer) (int, int, error) {
+					roundTrip()
+					return len(offers), 0, nil
+				}).AnyTimes()
+				repo.EXPECT().DeleteOffers(gomock.Any(), gomock.Any()).DoAndReturn(func(sellerId uint64, offerIds []uint64) (int64, error) {
+					roundTrip()
+					return int64(len(offerIds)), nil
+				}).AnyTimes()
+
+				service := services.NewServiceWithConfig(repo, services.Config{Workers: 1, QueueSize: 1, BatchSize: c.batchSize})
+				url := "http://localhost:1234/" + file
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					// Без Force повторы того же файла завершались бы статусом NoChanges, ничего не записывая
+					task, err := service.StartUploadingTask(123, url, services.TaskOptions{Force: true})
+					if err != nil {
+						b.Fatal(err)
+					}
+					waitTask(service, task.Id)
+				}
+			})
+		}
+	}
+}
+
+func TestService_UploadLimits(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	// Ни одна строка не должна попасть в базу: обращения к товарам не ожидаются
+	cases := []struct {
+		description string
+		cfg         services.Config
+		status      string
+	}{
+		{
+			description: "file larger than max_file_size",
+			cfg:         services.Config{Workers: 1, QueueSize: 1, MaxFileSize: 1000},
+			status:      "Error occured: file is too large: 8209 bytes, limit is 1000",
+		},
+		{
+			description: "more rows than max_rows",
+			cfg:         services.Config{Workers: 1, QueueSize: 1, MaxRows: 5},
+			status:      "Error occured: too many rows: 9 rows, limit is 5",
+		},
+	}
+
+	for _, c := range cases {
+		repo := mocks.NewMockRepository(mockCtrl)
+		expectTaskStorage(repo)
+		service := services.NewServiceWithConfig(repo, c.cfg)
+		fmt.Println(c.description)
+		task, err := service.StartUploadingTask(123, "http://localhost:1234/testdata1", services.TaskOptions{})
+		g.Expect(err).ShouldNot(HaveOccurred())
+		task = waitTask(service, task.Id)
+		g.Expect(task.StatusCode).Should(Equal(http.StatusBadRequest))
+		g.Expect(task.Status).Should(Equal(c.status))
+	}
+}
+
+func TestService_LargeFile(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	// Таблица больше буфера разобранных строк, с пропущенной строкой посередине
+	const rows = 5000
+	file := xlsx.NewFile()
+	sheet, err := file.AddSheet("offers")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	header := sheet.AddRow()
+	for _, name := range []string{"offer_id", "name", "price", "quantity", "available"} {
+		header.AddCell().SetString(name)
+	}
+	for i := 1; i <= rows; i++ {
+		if i == rows/2 {
+			sheet.AddRow()
+			continue
+		}
+		row := sheet.AddRow()
+		row.AddCell().SetInt(i)
+		row.AddCell().SetString(fmt.Sprintf("offer %d", i))
+		row.AddCell().SetInt(i * 10)
+		row.AddCell().SetInt(1)
+		row.AddCell().SetBool(true)
+	}
+	var buf bytes.Buffer
+	g.Expect(file.Write(&buf)).Should(Succeed())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	var upserted []models.Offer
+	repo.EXPECT().UpsertOffers(uint64(123), gomock.Any()).DoAndReturn(func(sellerId uint64, offers []models.Offer) (int, int, error) {
+		upserted = append(upserted, offers...)
+		return len(offers), 0, nil
+	}).AnyTimes()
+	service := services.NewServiceWithConfig(repo, services.Config{Workers: 1, QueueSize: 1, BatchSize: 500})
+
+	task, err := service.StartUploadingTask(123, server.URL, services.TaskOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	task = waitTask(service, task.Id)
+	g.Expect(task.Status).Should(Equal(models.TaskStatusCompleted))
+	g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: rows - 1, Errors: 1}))
+	g.Expect(upserted[rows-2]).Should(Equal(models.Offer{OfferId: rows, SellerId: 123, Name: "offer 5000", Price: rows * 10, Quantity: 1, Available: true}))
+
+	rowErrors, _, err := service.GetTaskErrors(task.Id, 0, 0)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(rowErrors).Should(HaveLen(1))
+	g.Expect(rowErrors[0].Row).Should(Equal(rows/2 + 1))
+	g.Expect(rowErrors[0].Reason).Should(Equal(models.RowErrorMissingCells))
+}
+
+func TestService_BatchSizeLimit(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	rows := repositories.MaxUpsertBatchSize + 100
+	var csvData bytes.Buffer
+	csvData.WriteString("offer_id,name,price,quantity,available\n")
+	for i := 1; i <= rows; i++ {
+		fmt.Fprintf(&csvData, "%d,offer %d,10,1,true\n", i, i)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write(csvData.Bytes())
+	}))
+	defer server.Close()
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	// Пачка больше MaxUpsertBatchSize превысила бы лимит параметров запроса PostgreSQL
+	var batches []int
+	repo.EXPECT().UpsertOffers(uint64(123), gomock.Any()).DoAndReturn(func(sellerId uint64, offers []models.Offer) (int, int, error) {
+		batches = append(batches, len(offers))
+		return len(offers), 0, nil
+	}).AnyTimes()
+	service := services.NewServiceWithConfig(repo, services.Config{Workers: 1, QueueSize: 1, BatchSize: 100000})
+
+	task, err := service.StartUploadingTask(123, server.URL, services.TaskOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	task = waitTask(service, task.Id)
+	g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: rows}))
+	g.Expect(batches).Should(Equal([]int{repositories.MaxUpsertBatchSize, 100}))
+}
+
+// dropEmptyXlsxRows убирает из листов книги строки без ячеек, как их не записывает Excel
+func dropEmptyXlsxRows(data []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	emptyRow := regexp.MustCompile(`<row[^>]*>\s*</row>|<row[^>]*/>`)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(f.Name, "xl/worksheets/") {
+			content = emptyRow.ReplaceAll(content, nil)
+		}
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func TestService_XlsxSkippedRows(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	// Строки 3-5 в листе отсутствуют, но отдаются пустыми, поэтому строк без заголовка 5, а не 2
+	file := xlsx.NewFile()
+	sheet, err := file.AddSheet("offers")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	header := sheet.AddRow()
+	for _, name := range []string{"offer_id", "name", "price", "quantity", "available"} {
+		header.AddCell().SetString(name)
+	}
+	for i := 2; i <= 6; i++ {
+		row := sheet.AddRow()
+		if i > 2 && i < 6 {
+			continue
+		}
+		row.AddCell().SetInt(i)
+		row.AddCell().SetString(fmt.Sprintf("offer %d", i))
+		row.AddCell().SetInt(100)
+		row.AddCell().SetInt(1)
+		row.AddCell().SetBool(true)
+	}
+	var buf bytes.Buffer
+	g.Expect(file.Write(&buf)).Should(Succeed())
+	data, err := dropEmptyXlsxRows(buf.Bytes())
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	service := services.NewServiceWithConfig(repo, services.Config{Workers: 1, QueueSize: 1, MaxRows: 4})
+	task, err := service.StartUploadingTask(123, server.URL, services.TaskOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	task = waitTask(service, task.Id)
+	g.Expect(task.Status).Should(Equal("Error occured: too many rows: 5 rows, limit is 4"))
+
+	// Пробный запуск только ищет товары
+	repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).AnyTimes()
+	service = services.NewServiceWithConfig(repo, services.Config{Workers: 1, QueueSize: 1})
+	task, err = service.StartUploadingTask(123, server.URL, services.TaskOptions{DryRun: true})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	task = waitTask(service, task.Id)
+	g.Expect(task.TotalRows).Should(Equal(5))
+	g.Expect(task.ProcessedRows).Should(Equal(task.TotalRows))
+}
+
+func TestService_CsvImport(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	csvData, err := ioutil.ReadFile("./testdata/testdata5.csv")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	// Сервер без Content-Type и расширения в ссылке: формат определяется по содержимому
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(csvData)
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		description string
+		url         string
+		opts        services.TaskOptions
+		result      func(task *services.Task)
+	}{
+		{
+			description: "csv with semicolons, BOM and decimal commas",
+			url:         "http://localhost:1234/testdata5.csv",
+			opts:        services.TaskOptions{DecimalSeparator: ','},
+			result: func(task *services.Task) {
+				g.Expect(task.Format).Should(Equal(services.FormatCSV))
+				g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: 2, Errors: 1}))
+				g.Expect(task.Preview.Created).Should(Equal([]models.Offer{
+					{OfferId: 1, SellerId: 123, Name: "Чайник", Price: 1500, Quantity: 10, Available: true},
+					{OfferId: 2, SellerId: 123, Name: "Кружка; белая", Price: 250, Quantity: 5, Available: true},
+				}))
+				g.Expect(task.Preview.Errors).Should(HaveLen(1))
+				g.Expect(task.Preview.Errors[0].Row).Should(Equal(4))
+				g.Expect(task.Preview.Errors[0].Reason).Should(Equal(models.RowErrorBadPrice))
+			},
+		},
+		{
+			description: "decimal commas are errors without decimal_separator",
+			url:         "http://localhost:1234/testdata5.csv",
+			result: func(task *services.Task) {
+				g.Expect(task.Info.Errors).Should(Equal(3))
+			},
+		},
+		{
+			description: "format detected by content",
+			url:         server.URL,
+			opts:        services.TaskOptions{DecimalSeparator: ','},
+			result: func(task *services.Task) {
+				g.Expect(task.Format).Should(Equal(services.FormatCSV))
+				g.Expect(task.Info.Created).Should(Equal(2))
+			},
+		},
+		{
+			description: "tsv in windows-1251",
+			url:         "http://localhost:1234/testdata6.tsv",
+			opts:        services.TaskOptions{Encoding: services.EncodingWindows1251},
+			result: func(task *services.Task) {
+				g.Expect(task.Format).Should(Equal(services.FormatTSV))
+				g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: 2}))
+				g.Expect(task.Preview.Created[0].Name).Should(Equal("Чайник"))
+				g.Expect(task.Preview.Created[1].Name).Should(Equal("Кружка"))
+			},
+		},
+		{
+			description: "explicit format overrides detection",
+			url:         "http://localhost:1234/testdata5.csv",
+			opts:        services.TaskOptions{Format: services.FormatXLSX},
+			result: func(task *services.Task) {
+				g.Expect(task.StatusCode).Should(Equal(http.StatusBadRequest))
+				g.Expect(task.Format).Should(Equal(services.FormatXLSX))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		repo := mocks.NewMockRepository(mockCtrl)
+		expectTaskStorage(repo)
+		repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).AnyTimes()
+		service := services.NewService(repo)
+		fmt.Println(c.description)
+		c.opts.DryRun = true
+		task, err := service.StartUploadingTask(123, c.url, c.opts)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		c.result(waitTask(service, task.Id))
+	}
+}
+
+func TestService_LargeOfferIds(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	// Больше 2^53: через float64 превратились бы в 9007199254740992 и 1234567890123456800
+	cases := []struct {
+		description string
+		contentType string
+		data        string
+	}{
+		{
+			description: "csv",
+			contentType: "text/csv",
+			data:        "offer_id,name,price,quantity,available\n9007199254740993,kek,100,1,true\n1234567890123456789,lol,9007199254740993,1,true\n",
+		},
+		{
+			description: "ndjson",
+			contentType: "application/x-ndjson",
+			data: `{"offer_id": 9007199254740993, "name": "kek", "price": 100, "quantity": 1, "available": true}
+{"offer_id": 1234567890123456789, "name": "lol", "price": 9007199254740993, "quantity": 1, "available": true}
+`,
+		},
+	}
+
+	for _, c := range cases {
+		fmt.Println(c.description)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", c.contentType)
+			w.Write([]byte(c.data))
+		}))
+
+		repo := mocks.NewMockRepository(mockCtrl)
+		expectTaskStorage(repo)
+		repo.EXPECT().FindOffer(uint64(9007199254740993), uint64(123)).Return(nil, gorm.ErrRecordNotFound)
+		repo.EXPECT().FindOffer(uint64(1234567890123456789), uint64(123)).Return(nil, gorm.ErrRecordNotFound)
+		repo.EXPECT().NewOffer(uint64(9007199254740993), uint64(123), "kek", int64(100), 1, true).Return(&models.Offer{}, nil)
+		repo.EXPECT().NewOffer(uint64(1234567890123456789), uint64(123), "lol", int64(9007199254740993), 1, true).Return(&models.Offer{}, nil)
+		service := services.NewService(repo)
+
+		task, err := service.StartUploadingTask(123, server.URL, services.TaskOptions{})
+		g.Expect(err).ShouldNot(HaveOccurred())
+		task = waitTask(service, task.Id)
+		g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: 2}))
+		server.Close()
+	}
+}
+
+func TestService_JsonImport(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	cases := []struct {
+		description string
+		url         string
+		expect      func(repo *mocks.MockRepository)
+		result      func(task *services.Task, rowErrors []models.TaskRowError)
+	}{
+		{
+			description: "json array - rows validated like spreadsheet rows",
+			url:         "http://localhost:1234/testdata7.json",
+			expect: func(repo *mocks.MockRepository) {
+				gomock.InOrder(
+					repo.EXPECT().FindOffer(uint64(1), uint64(123)).Return(nil, gorm.ErrRecordNotFound),
+					repo.EXPECT().FindOffer(uint64(2), uint64(123)).Return(&models.Offer{OfferId: 2, SellerId: 123}, nil),
+					repo.EXPECT().FindOffer(uint64(3), uint64(123)).Return(&models.Offer{OfferId: 3, SellerId: 123}, nil),
+				)
+				repo.EXPECT().NewOffer(uint64(1), uint64(123), "kek", int64(100), 5, true).Return(&models.Offer{}, nil)
+				repo.EXPECT().UpdateColumns(&models.Offer{OfferId: 2, SellerId: 123}, "lol", int64(250), 1, true).Return(nil)
+				repo.EXPECT().Delete(&models.Offer{OfferId: 3, SellerId: 123})
+			},
+			result: func(task *services.Task, rowErrors []models.TaskRowError) {
+				g.Expect(task.Status).Should(Equal(models.TaskStatusCompleted))
+				g.Expect(task.Format).Should(Equal(services.FormatJSON))
+				g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: 1, Updated: 1, Deleted: 1, Errors: 4}))
+
+				reasons := map[int]string{}
+				for _, e := range rowErrors {
+					reasons[e.Row] = e.Reason
+				}
+				g.Expect(reasons).Should(Equal(map[int]string{
+					4: models.RowErrorBadOfferId,
+					5: models.RowErrorNegativePrice,
+					6: models.RowErrorBadQuantity,
+					7: models.RowErrorMissingCells,
+				}))
+			},
+		},
+		{
+			description: "ndjson - empty lines are skipped",
+			url:         "http://localhost:1234/testdata8.ndjson",
+			expect: func(repo *mocks.MockRepository) {
+				repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).Times(2)
+				repo.EXPECT().NewOffer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(&models.Offer{}, nil).Times(2)
+			},
+			result: func(task *services.Task, rowErrors []models.TaskRowError) {
+				g.Expect(task.Format).Should(Equal(services.FormatNDJSON))
+				g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: 2, Errors: 1}))
+				g.Expect(rowErrors[0].Row).Should(Equal(3))
+				g.Expect(rowErrors[0].Reason).Should(Equal(models.RowErrorNegativeQuantity))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		repo := mocks.NewMockRepository(mockCtrl)
+		c.expect(repo)
+		expectTaskStorage(repo)
+		service := services.NewService(repo)
+		fmt.Println(c.description)
+		task, err := service.StartUploadingTask(123, c.url, services.TaskOptions{})
+		g.Expect(err).ShouldNot(HaveOccurred())
+		task = waitTask(service, task.Id)
+		rowErrors, _, err := service.GetTaskErrors(task.Id, 0, 0)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		c.result(task, rowErrors)
+	}
+}
+
+func TestService_FileUpload(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	data, err := ioutil.ReadFile("./testdata/testdata1.xlsx")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	spoolDir := t.TempDir()
+
+	cases := []struct {
+		description string
+		cfg         services.Config
+		result      func(task *services.Task, err error)
+	}{
+		{
+			description: "uploaded file is parsed like downloaded one",
+			cfg:         services.Config{Workers: 1, QueueSize: 1, SpoolDir: spoolDir},
+			result: func(task *services.Task, err error) {
+				g.Expect(err).ShouldNot(HaveOccurred())
+				g.Expect(task.StatusCode).Should(Equal(http.StatusOK))
+				g.Expect(task.Format).Should(Equal(services.FormatXLSX))
+				g.Expect(task.FileName).Should(Equal("prices.xlsx"))
+			},
+		},
+		{
+			description: "file larger than max_file_size is rejected before queueing",
+			cfg:         services.Config{Workers: 1, QueueSize: 1, SpoolDir: spoolDir, MaxFileSize: 1000},
+			result: func(task *services.Task, err error) {
+				g.Expect(errors.Is(err, services.ErrFileTooLarge)).Should(BeTrue())
+			},
+		},
+	}
+
+	for _, c := range cases {
+		repo := mocks.NewMockRepository(mockCtrl)
+		expectTaskStorage(repo)
+		repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).AnyTimes()
+		service := services.NewServiceWithConfig(repo, c.cfg)
+		fmt.Println(c.description)
+		task, err := service.StartUploadingFileTask(123, services.UploadedFile{
+			Name: "prices.xlsx",
+			Body: bytes.NewReader(data),
+		}, services.TaskOptions{DryRun: true})
+		if err == nil {
+			task = waitTask(service, task.Id)
+		}
+		c.result(task, err)
+
+		// Временный файл удаляется после завершения задания
+		files, err := ioutil.ReadDir(spoolDir)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		g.Expect(files).Should(BeEmpty())
+	}
+}
+
+func TestService_ColumnMapping(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	cases := []struct {
+		description string
+		fileName    string
+		content     string
+		columns     map[string]string
+		result      func(task *services.Task)
+	}{
+		{
+			description: "columns found by russian names in any order, extra columns ignored",
+			fileName:    "prices.csv",
+			content:     "Цена;Артикул;Комментарий;Наименование;В наличии;Остаток\n1500;1;хит;Чайник;true;10\n",
+			result: func(task *services.Task) {
+				g.Expect(task.StatusCode).Should(Equal(http.StatusOK))
+				g.Expect(task.Preview.Created).Should(Equal([]models.Offer{
+					{OfferId: 1, SellerId: 123, Name: "Чайник", Price: 1500, Quantity: 10, Available: true},
+				}))
+			},
+		},
+		{
+			description: "explicit mapping by name and column number",
+			fileName:    "prices.csv",
+			content:     "Цена с НДС;Код;name;quantity;available\n250;2;Кружка;5;true\n",
+			columns:     map[string]string{"price": "цена с ндс", "offer_id": "2"},
+			result: func(task *services.Task) {
+				g.Expect(task.StatusCode).Should(Equal(http.StatusOK))
+				g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: 1}))
+			},
+		},
+		{
+			description: "missing required columns fail the task",
+			fileName:    "prices.csv",
+			content:     "offer_id;name;price\n1;Чайник;1500\n",
+			result: func(task *services.Task) {
+				g.Expect(task.StatusCode).Should(Equal(http.StatusBadRequest))
+				g.Expect(task.Status).Should(Equal("Error occured: missing required columns: quantity, available"))
+			},
+		},
+		{
+			description: "explicit mapping renames json fields",
+			fileName:    "prices.json",
+			content:     `[{"sku": 3, "name": "Ложка", "price": 50, "quantity": 7, "available": true}]`,
+			columns:     map[string]string{"offer_id": "sku"},
+			result: func(task *services.Task) {
+				g.Expect(task.StatusCode).Should(Equal(http.StatusOK))
+				g.Expect(task.Preview.Created).Should(HaveLen(1))
+				g.Expect(task.Preview.Created[0].OfferId).Should(Equal(uint64(3)))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		repo := mocks.NewMockRepository(mockCtrl)
+		expectTaskStorage(repo)
+		repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).AnyTimes()
+		service := services.NewService(repo)
+		fmt.Println(c.description)
+		task, err := service.StartUploadingFileTask(123, services.UploadedFile{
+			Name: c.fileName,
+			Body: strings.NewReader(c.content),
+		}, services.TaskOptions{DryRun: true, Columns: c.columns})
+		g.Expect(err).ShouldNot(HaveOccurred())
+		c.result(waitTask(service, task.Id))
+	}
+}
+
+func TestService_Sheets(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	// Каталог, разбитый по листам: у каждого листа свой заголовок, пустой лист пропускается
+	file := xlsx.NewFile()
+	sheets := []struct {
+		name string
+		rows [][]string
+	}{
+		{"Чайники", [][]string{
+			{"Артикул", "Наименование", "Цена", "Количество", "В наличии"},
+			{"1", "Чайник", "1500", "10", "true"},
+			{"2", "Чайник", "-1", "1", "true"},
+		}},
+		{"Кружки", [][]string{
+			{"price", "offer_id", "name", "available", "quantity"},
+			{"250", "10", "Кружка", "true", "5"},
+		}},
+		{"Пусто", nil},
+	}
+	for _, s := range sheets {
+		sheet, err := file.AddSheet(s.name)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		for _, values := range s.rows {
+			row := sheet.AddRow()
+			for _, value := range values {
+				row.AddCell().SetString(value)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	g.Expect(file.Write(&buf)).Should(Succeed())
+
+	cases := []struct {
+		description string
+		sheet       string
+		result      func(task *services.Task)
+	}{
+		{
+			description: "first sheet by default",
+			result: func(task *services.Task) {
+				g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: 1, Errors: 1}))
+				g.Expect(task.Preview.Errors[0].Sheet).Should(BeEmpty())
+			},
+		},
+		{
+			description: "sheet selected by name",
+			sheet:       "Кружки",
+			result: func(task *services.Task) {
+				g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: 1}))
+				g.Expect(task.Preview.Created[0].OfferId).Should(Equal(uint64(10)))
+			},
+		},
+		{
+			description: "sheet selected by number",
+			sheet:       "2",
+			result: func(task *services.Task) {
+				g.Expect(task.Preview.Created[0].OfferId).Should(Equal(uint64(10)))
+			},
+		},
+		{
+			description: "all sheets - per-sheet counters and errors attributed to sheets",
+			sheet:       services.AllSheets,
+			result: func(task *services.Task) {
+				g.Expect(task.StatusCode).Should(Equal(http.StatusOK))
+				g.Expect(task.Info).Should(Equal(models.TaskInfo{Created: 2, Errors: 1, Sheets: models.SheetsInfo{
+					{Name: "Чайники", Created: 1, Errors: 1},
+					{Name: "Кружки", Created: 1},
+				}}))
+				g.Expect(task.Preview.Errors).Should(HaveLen(1))
+				g.Expect(task.Preview.Errors[0].Sheet).Should(Equal("Чайники"))
+				g.Expect(task.Preview.Errors[0].Row).Should(Equal(3))
+			},
+		},
+		{
+			description: "unknown sheet fails the task",
+			sheet:       "Ложки",
+			result: func(task *services.Task) {
+				g.Expect(task.StatusCode).Should(Equal(http.StatusBadRequest))
+				g.Expect(task.Status).Should(Equal(`Error occured: sheet not found: "Ложки"`))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		repo := mocks.NewMockRepository(mockCtrl)
+		expectTaskStorage(repo)
+		repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).AnyTimes()
+		service := services.NewService(repo)
+		fmt.Println(c.description)
+		task, err := service.StartUploadingFileTask(123, services.UploadedFile{
+			Name: "catalog.xlsx",
+			Body: bytes.NewReader(buf.Bytes()),
+		}, services.TaskOptions{DryRun: true, Sheet: c.sheet})
+		g.Expect(err).ShouldNot(HaveOccurred())
+		c.result(waitTask(service, task.Id))
+	}
+}
+
+func TestService_UnchangedFile(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).AnyTimes()
+	// Строки применяются только при первом импорте и при повторе с force
+	repo.EXPECT().NewOffer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&models.Offer{}, nil).Times(18)
+	service := services.NewService(repo)
+
+	run := func(sellerId uint64, opts services.TaskOptions) *services.Task {
+		task, err := service.StartUploadingTask(sellerId, "http://localhost:1234/testdata1", opts)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		return waitTask(service, task.Id)
+	}
+
+	fmt.Println("first import applies rows")
+	first := run(123, services.TaskOptions{})
+	g.Expect(first.Status).Should(Equal(models.TaskStatusCompleted))
+	g.Expect(first.ContentHash).ShouldNot(BeEmpty())
+
+	fmt.Println("same file again - no changes")
+	again := run(123, services.TaskOptions{})
+	g.Expect(again.Status).Should(Equal(models.TaskStatusNoChanges))
+	g.Expect(again.StatusCode).Should(Equal(http.StatusOK))
+	g.Expect(again.PreviousTaskId).Should(Equal(first.Id))
+	g.Expect(again.ContentHash).Should(Equal(first.ContentHash))
+	g.Expect(again.Info).Should(Equal(models.TaskInfo{}))
+
+	fmt.Println("dry run and other parsing options are not skipped")
+	g.Expect(run(123, services.TaskOptions{DryRun: true}).Status).Should(Equal(models.TaskStatusCompleted))
+	other := run(123, services.TaskOptions{DryRun: true, Sheet: "1"})
+	g.Expect(other.ContentHash).ShouldNot(Equal(first.ContentHash))
+
+	fmt.Println("force re-runs import")
+	forced := run(123, services.TaskOptions{Force: true})
+	g.Expect(forced.Status).Should(Equal(models.TaskStatusCompleted))
+	g.Expect(forced.Info.Created).Should(Equal(9))
+}
+
+func TestService_RetryAfterDbFailure(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).AnyTimes()
+	// При первом импорте база недоступна, при повторе строки записываются
+	gomock.InOrder(
+		repo.EXPECT().NewOffer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil, errors.New("connection refused")).Times(9),
+		repo.EXPECT().NewOffer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&models.Offer{}, nil).Times(9),
+	)
+	service := services.NewService(repo)
+
+	run := func() *services.Task {
+		task, err := service.StartUploadingTask(123, "http://localhost:1234/testdata1", services.TaskOptions{})
+		g.Expect(err).ShouldNot(HaveOccurred())
+		return waitTask(service, task.Id)
+	}
+
+	fmt.Println("first import fails to write rows")
+	first := run()
+	g.Expect(first.StatusCode).Should(Equal(http.StatusOK))
+	g.Expect(first.Info.Errors).Should(Equal(9))
+	g.Expect(first.Info.Created).Should(Equal(0))
+
+	fmt.Println("same file again - rows are written")
+	again := run()
+	g.Expect(again.Status).Should(Equal(models.TaskStatusCompleted))
+	g.Expect(again.PreviousTaskId).Should(BeEmpty())
+	g.Expect(again.Info.Created).Should(Equal(9))
+	g.Expect(again.Info.Errors).Should(Equal(0))
+
+	fmt.Println("successful import is not repeated")
+	g.Expect(run().Status).Should(Equal(models.TaskStatusNoChanges))
+}
+
+func TestService_ChangedAfterImport(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).AnyTimes()
+	repo.EXPECT().NewOffer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&models.Offer{}, nil).AnyTimes()
+	repo.EXPECT().FindOffers(gomock.Any()).Return(nil, errors.New("connection refused"))
+	service := services.NewService(repo)
+
+	run := func(url string, opts services.TaskOptions) *services.Task {
+		task, err := service.StartUploadingTask(123, url, opts)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		return waitTask(service, task.Id)
+	}
+
+	first := run("http://localhost:1234/testdata1", services.TaskOptions{})
+	g.Expect(first.Status).Should(Equal(models.TaskStatusCompleted))
+
+	fmt.Println("other file failed after writing rows - same file is imported again")
+	other := run("http://localhost:1234/testdata5.csv", services.TaskOptions{Mode: services.ModeFullSync})
+	g.Expect(other.Status).Should(Equal(models.TaskStatusRolledBack))
+	g.Expect(other.Info.Created).ShouldNot(BeZero())
+	again := run("http://localhost:1234/testdata1", services.TaskOptions{})
+	g.Expect(again.Status).Should(Equal(models.TaskStatusCompleted))
+	g.Expect(again.Info.Created).Should(Equal(9))
+
+	fmt.Println("offers changed through API - same file is imported again")
+	g.Expect(repo.MarkImportsStale(123)).ShouldNot(HaveOccurred())
+	again = run("http://localhost:1234/testdata1", services.TaskOptions{})
+	g.Expect(again.Status).Should(Equal(models.TaskStatusCompleted))
+	g.Expect(again.Info.Created).Should(Equal(9))
+
+	fmt.Println("nothing changed since - no changes")
+	g.Expect(run("http://localhost:1234/testdata1", services.TaskOptions{}).Status).Should(Equal(models.TaskStatusNoChanges))
+}
+
+func TestService_IdempotencyKey(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	data, err := ioutil.ReadFile("./testdata/testdata1.xlsx")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	spoolDir := t.TempDir()
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).AnyTimes()
+	service := services.NewServiceWithConfig(repo, services.Config{Workers: 1, QueueSize: 10, SpoolDir: spoolDir})
+	opts := services.TaskOptions{DryRun: true, IdempotencyKey: "retry-1"}
+
+	first, err := service.StartUploadingTask(123, "http://localhost:1234/testdata1", opts)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(first.Replayed).Should(BeFalse())
+
+	fmt.Println("retry while task is running returns the same task")
+	retry, err := service.StartUploadingTask(123, "http://localhost:1234/testdata1", opts)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(retry.Id).Should(Equal(first.Id))
+	g.Expect(retry.Replayed).Should(BeTrue())
+	waitTask(service, first.Id)
+
+	fmt.Println("retry is found before the file is uploaded")
+	existing, err := service.CheckNewTask(123, "retry-1")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(existing.Id).Should(Equal(first.Id))
+	g.Expect(existing.Replayed).Should(BeTrue())
+	existing, err = service.CheckNewTask(123, "retry-2")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(existing).Should(BeNil())
+
+	fmt.Println("retry after task is finished returns it from storage")
+	retry, err = service.StartUploadingFileTask(123, services.UploadedFile{Name: "prices.xlsx", Body: bytes.NewReader(data)}, opts)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(retry.Id).Should(Equal(first.Id))
+	g.Expect(retry.StatusCode).Should(Equal(http.StatusOK))
+	g.Expect(retry.Replayed).Should(BeTrue())
+	files, err := ioutil.ReadDir(spoolDir)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(files).Should(BeEmpty())
+
+	fmt.Println("keys are scoped by seller")
+	another, err := service.StartUploadingTask(456, "http://localhost:1234/testdata1", opts)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(another.Id).ShouldNot(Equal(first.Id))
+	waitTask(service, another.Id)
+}
+
+func TestService_Callback(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	// Первая попытка отклоняется, вторая принимается
+	var mu sync.Mutex
+	var received [][]byte
+	var signatures []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, body)
+		signatures = append(signatures, r.Header.Get(services.SignatureHeader))
+		if len(received) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).AnyTimes()
+	service := services.NewServiceWithConfig(repo, services.Config{
+		Workers:         1,
+		QueueSize:       1,
+		WebhookSecret:   "secret",
+		WebhookAttempts: 3,
+		WebhookBackoff:  time.Millisecond,
+	})
+
+	task, err := service.StartUploadingTask(123, "http://localhost:1234/testdata1",
+		services.TaskOptions{DryRun: true, CallbackURL: server.URL})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(waitTask(service, task.Id).Status).Should(Equal(models.TaskStatusCompleted))
+
+	g.Eventually(func() int {
+		task, _ := service.GetTask(task.Id)
+		return len(task.CallbackAttempts)
+	}).Should(Equal(2))
+	task, _ = service.GetTask(task.Id)
+	g.Expect(task.CallbackAttempts[0].StatusCode).Should(Equal(http.StatusInternalServerError))
+	g.Expect(task.CallbackAttempts[0].Error).ShouldNot(BeEmpty())
+	g.Expect(task.CallbackAttempts[1].StatusCode).Should(Equal(http.StatusOK))
+	g.Expect(task.CallbackAttempts[1].Error).Should(BeEmpty())
+
+	mu.Lock()
+	defer mu.Unlock()
+	g.Expect(received).Should(HaveLen(2))
+	g.Expect(signatures[1]).Should(Equal(services.SignPayload("secret", received[1])))
+	var delivered services.Task
+	g.Expect(json.Unmarshal(received[1], &delivered)).Should(Succeed())
+	g.Expect(delivered.Id).Should(Equal(task.Id))
+	g.Expect(delivered.Status).Should(Equal(models.TaskStatusCompleted))
+}
+
+func TestService_SubscribeTask(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	data, err := ioutil.ReadFile("./testdata/testdata1.xlsx")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	// Сервер отдает таблицу, только когда подписка уже оформлена
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).AnyTimes()
+	service := services.NewService(repo)
+
+	task, err := service.StartUploadingTask(123, server.URL, services.TaskOptions{DryRun: true})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	events, unsubscribe, err := service.SubscribeTask(task.Id)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	defer unsubscribe()
+	close(release)
+
+	var received []services.TaskEvent
+	for event := range events {
+		received = append(received, event)
+	}
+	g.Expect(received).ShouldNot(BeEmpty())
+	for i := 1; i < len(received); i++ {
+		g.Expect(received[i].Processed).Should(BeNumerically(">=", received[i-1].Processed))
+	}
+	last := received[len(received)-1]
+	g.Expect(last.Type).Should(Equal(services.EventStatus))
+	g.Expect(last.Status).Should(Equal(models.TaskStatusCompleted))
+	g.Expect(last.Processed).Should(Equal(9))
+	g.Expect(last.Total).Should(Equal(9))
+	g.Expect(last.Info.Created).Should(Equal(9))
+
+	fmt.Println("finished task - single final event")
+	events, _, err = service.SubscribeTask(task.Id)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	event, ok := <-events
+	g.Expect(ok).Should(BeTrue())
+	g.Expect(event.Status).Should(Equal(models.TaskStatusCompleted))
+	_, ok = <-events
+	g.Expect(ok).Should(BeFalse())
+
+	_, _, err = service.SubscribeTask("unknown")
+	g.Expect(err).Should(Equal(services.ErrTaskNotFound))
+}
+
+func TestParseCron(t *testing.T) {
+	g := NewWithT(t)
+
+	// Пятница
+	after := time.Date(2021, 1, 1, 10, 30, 0, 0, time.UTC)
+	cases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"*/15 * * * *", time.Date(2021, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2021, 1, 2, 3, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2021, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2021, 1, 2, 10, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC)},
+		// День месяца или день недели
+		{"0 0 15 * 6", time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Поле с * и шагом - должны совпасть оба дня
+		{"0 0 */2 * *", time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 */2 * 1", time.Date(2021, 1, 11, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * */2", time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		fmt.Println(c.expr)
+		expr, err := services.ParseCron(c.expr)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		g.Expect(expr.Next(after)).Should(Equal(c.next))
+	}
+
+	for _, invalid := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "*/0 * * * *", "5-1 * * * *", "0 0 30 2 *", "a * * * *", "70/5 * * * *", "0,70/5 * * * *", "0 24/2 * * *"} {
+		fmt.Println(invalid)
+		_, err := services.ParseCron(invalid)
+		g.Expect(errors.Is(err, services.ErrInvalidCron)).Should(BeTrue())
+	}
+}
+
+func TestScheduler_RunDueSchedules(t *testing.T) {
+	startTestdataServer()
+
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	expectTaskStorage(repo)
+	repo.EXPECT().FindOffer(gomock.Any(), gomock.Any()).Return(nil, gorm.ErrRecordNotFound).AnyTimes()
+	repo.EXPECT().NewOffer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	service := services.NewService(repo)
+	scheduler := services.NewScheduler(repo, service, time.Minute)
+
+	now := time.Date(2021, 1, 1, 3, 0, 20, 0, time.UTC)
+	repo.EXPECT().FindDueSchedules(now).Return([]models.Schedule{
+		{Id: "s1", SellerId: 123, URL: "http://localhost:1234/testdata1", Cron: "0 3 * * *", NextRunAt: &now},
+	}, nil)
+	var saved models.Schedule
+	repo.EXPECT().SaveSchedule(gomock.Any()).DoAndReturn(func(s *models.Schedule) error {
+		saved = *s
+		return nil
+	})
+
+	g.Expect(scheduler.RunDueSchedules(now)).Should(Equal(1))
+	g.Expect(saved.LastTaskId).ShouldNot(BeEmpty())
+	g.Expect(saved.LastError).Should(BeEmpty())
+	g.Expect(*saved.LastRunAt).Should(Equal(now))
+	g.Expect(*saved.NextRunAt).Should(Equal(time.Date(2021, 1, 2, 3, 0, 0, 0, time.UTC)))
+
+	task := waitTask(service, saved.LastTaskId)
+	g.Expect(task.ScheduleId).Should(Equal("s1"))
+	g.Expect(task.Info.Created).Should(Equal(9))
+
+	// Если задание не создано, причина сохраняется, а расписание сработает в следующий раз
+	tasks := mock_services.NewMockTaskService(mockCtrl)
+	scheduler = services.NewScheduler(repo, tasks, time.Minute)
+	repo.EXPECT().FindDueSchedules(now).Return([]models.Schedule{
+		{Id: "s2", SellerId: 123, URL: "http://example.com", Cron: "@hourly", NextRunAt: &now},
+	}, nil)
+	tasks.EXPECT().StartUploadingTask(uint64(123), "http://example.com", services.TaskOptions{ScheduleId: "s2"}).
+		Return(nil, services.ErrQueueFull)
+	repo.EXPECT().SaveSchedule(gomock.Any()).DoAndReturn(func(s *models.Schedule) error {
+		saved = *s
+		return nil
+	})
+
+	g.Expect(scheduler.RunDueSchedules(now)).Should(Equal(0))
+	g.Expect(saved.LastError).Should(Equal(services.ErrQueueFull.Error()))
+	g.Expect(*saved.NextRunAt).Should(Equal(time.Date(2021, 1, 1, 4, 0, 0, 0, time.UTC)))
+}
+
+func TestScheduler_Schedules(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	g := NewWithT(t)
+
+	repo := mocks.NewMockRepository(mockCtrl)
+	scheduler := services.NewScheduler(repo, mock_services.NewMockTaskService(mockCtrl), time.Minute)
+
+	var created models.Schedule
+	repo.EXPECT().CreateSchedule(gomock.Any()).DoAndReturn(func(s *models.Schedule) error {
+		created = *s
+		return nil
+	})
+	schedule, err := scheduler.CreateSchedule(1, "http://example.com", "0 3 * * *")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(schedule.Id).ShouldNot(BeEmpty())
+	g.Expect(created.Cron).Should(Equal("0 3 * * *"))
+	g.Expect(schedule.NextRunAt.After(time.Now())).Should(BeTrue())
+
+	_, err = scheduler.CreateSchedule(1, "http://example.com", "every night")
+	g.Expect(errors.Is(err, services.ErrInvalidCron)).Should(BeTrue())
+
+	// Пауза и возобновление
+	past := time.Now().Add(-48 * time.Hour)
+	repo.EXPECT().FindSchedule("s1").Return(&models.Schedule{Id: "s1", Cron: "0 3 * * *", NextRunAt: &past}, nil)
+	repo.EXPECT().SaveSchedule(gomock.Any()).Return(nil)
+	schedule, err = scheduler.PauseSchedule("s1", true)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(schedule.Paused).Should(BeTrue())
+
+	repo.EXPECT().FindSchedule("s1").Return(&models.Schedule{Id: "s1", Cron: "0 3 * * *", Paused: true, NextRunAt: &past}, nil)
+	repo.EXPECT().SaveSchedule(gomock.Any()).Return(nil)
+	schedule, err = scheduler.PauseSchedule("s1", false)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(schedule.Paused).Should(BeFalse())
+	// Пропущенные за время паузы срабатывания не выполняются
+	g.Expect(schedule.NextRunAt.After(time.Now())).Should(BeTrue())
+
+	repo.EXPECT().FindSchedule("unknown").Return(nil, gorm.ErrRecordNotFound).Times(2)
+	_, err = scheduler.PauseSchedule("unknown", true)
+	g.Expect(err).Should(Equal(services.ErrScheduleNotFound))
+	_, _, err = scheduler.GetScheduleTasks("unknown", 10, 0)
+	g.Expect(err).Should(Equal(services.ErrScheduleNotFound))
+
+	repo.EXPECT().DeleteSchedule("s1").Return(int64(1), nil)
+	g.Expect(scheduler.DeleteSchedule("s1")).ShouldNot(HaveOccurred())
+	repo.EXPECT().DeleteSchedule("s1").Return(int64(0), nil)
+	g.Expect(scheduler.DeleteSchedule("s1")).Should(Equal(services.ErrScheduleNotFound))
 }
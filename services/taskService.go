@@ -1,91 +1,268 @@
 package services
 
 import (
+	"MartellX/avito-tech-task/models"
 	"MartellX/avito-tech-task/repositories"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gofrs/uuid"
 	"github.com/labstack/gommon/log"
-	"github.com/tealeg/xlsx"
 	"gorm.io/gorm"
-	"io/ioutil"
+	"io"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type TaskServiceImpl struct {
-	repo  repositories.Repository
-	tasks map[string]*Task
+	repo repositories.Repository
+	cfg  Config
+
+	mu     sync.RWMutex
+	active map[string]*taskState
+
+	jobs      chan job
+	enqueueMu sync.Mutex
+	enqueued  uint64
+	dequeued  uint64
 }
 
 func NewService(repo repositories.Repository) *TaskServiceImpl {
-	return &TaskServiceImpl{repo: repo, tasks: map[string]*Task{}}
+	return NewServiceWithConfig(repo, DefaultConfig())
+}
+
+func NewServiceWithConfig(repo repositories.Repository, cfg Config) *TaskServiceImpl {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize < 1 {
+		cfg.QueueSize = 1
+	}
+	if cfg.WebhookAttempts < 1 {
+		cfg.WebhookAttempts = 1
+	}
+	// Пачка больше не поместится в один запрос, и все ее строки получили бы db_failure
+	if cfg.BatchSize > repositories.MaxUpsertBatchSize {
+		log.Warnf("batch_size %d is too large, using %d", cfg.BatchSize, repositories.MaxUpsertBatchSize)
+		cfg.BatchSize = repositories.MaxUpsertBatchSize
+	}
+	if cfg.SpoolDir != "" {
+		if err := os.MkdirAll(cfg.SpoolDir, 0700); err != nil {
+			log.Error(err)
+		}
+	}
+	s := &TaskServiceImpl{
+		repo:   repo,
+		cfg:    cfg,
+		active: map[string]*taskState{},
+		jobs:   make(chan job, cfg.QueueSize),
+	}
+	s.startWorkers(cfg.Workers)
+	return s
 }
 
-type Task struct {
-	Id         string `json:"task_id"`
-	Status     string `json:"status"`
-	StatusCode int    `json:"status_code"`
-	SellerId   uint64 `json:"-"`
+type Task = models.Task
+
+// Через сколько обработанных строк сохранять промежуточные счетчики задания
+const progressSaveInterval = 100
+
+// GetTask возвращает копию задания: для выполняющихся - из памяти, для остальных - из базы
+func (s *TaskServiceImpl) GetTask(id string) (*Task, bool) {
+	s.mu.RLock()
+	state, ok := s.active[id]
+	s.mu.RUnlock()
+	if ok {
+		task := s.snapshot(state)
+		task.ComputeProgress(time.Now())
+		return task, true
+	}
 
-	Info struct {
-		Created int `json:"created,omitempty"`
-		Updated int `json:"updated,omitempty"`
-		Deleted int `json:"deleted,omitempty"`
-		Errors  int `json:"errors,omitempty"`
-	} `json:"info,omitempty"`
+	task, err := s.repo.FindTask(id)
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			log.Error(err)
+		}
+		return nil, false
+	}
+	task.ComputeProgress(time.Now())
+	return task, true
 }
 
-func (t *Task) SetStatus(status string, code int) {
-	t.Status = status
-	t.StatusCode = code
+// InterruptUnfinishedTasks помечает прерванными задания, которые не успели завершиться до остановки сервиса
+func (s *TaskServiceImpl) InterruptUnfinishedTasks() (int64, error) {
+	return s.repo.UpdateTasksStatus(models.UnfinishedTaskCodes, models.TaskStatusInterrupted, http.StatusInternalServerError)
 }
 
-func (s *TaskServiceImpl) GetTask(id string) (*Task, bool) {
-	task, ok := s.tasks[id]
-	return task, ok
+func (s *TaskServiceImpl) snapshot(state *taskState) *Task {
+	task := state.snapshot()
+	if task.StatusCode == http.StatusAccepted {
+		task.QueuePosition = s.queuePosition(state)
+	}
+	return task
 }
 
-func (s *TaskServiceImpl) createTask(sellerId uint64) *Task {
+// createTask сохраняет новое задание по шаблону task, в котором заполнены продавец и источник таблицы
+func (s *TaskServiceImpl) createTask(task Task, opts TaskOptions, queueSeq uint64) (*taskState, error) {
 	taskUUID, _ := uuid.DefaultGenerator.NewV4()
 	id := taskUUID.String()
-	task := &Task{
-		Id:         id,
-		Status:     "Created",
-		StatusCode: http.StatusCreated,
-		SellerId:   sellerId,
+	task.Id = id
+	task.SetStatus(models.TaskStatusQueued, http.StatusAccepted)
+	task.DryRun = opts.DryRun
+	task.Atomic = opts.Atomic
+	task.Mode = opts.Mode
+	task.IdempotencyKey = opts.IdempotencyKey
+	task.CallbackURL = opts.CallbackURL
+	task.ScheduleId = opts.ScheduleId
+	if err := s.repo.CreateTask(&task); err != nil {
+		return nil, err
 	}
-	s.tasks[id] = task
-	return task
+
+	state := newTaskState(task, s.repo, queueSeq, opts, s.cfg.BatchSize)
+	s.mu.Lock()
+	s.active[id] = state
+	s.mu.Unlock()
+	return state, nil
 }
 
-func (s *TaskServiceImpl) StartUploadingTask(sellerId uint64, xlsxURL string) (task *Task, err error) {
+// finishTask сохраняет итоговое состояние задания, убирает его из памяти и отправляет на callback_url
+func (s *TaskServiceImpl) finishTask(state *taskState) {
+	state.update(func(t *Task) {
+		now := time.Now()
+		t.FinishedAt = &now
+	})
+	state.save()
+	s.mu.Lock()
+	delete(s.active, state.id())
+	s.mu.Unlock()
+	state.closeSubscribers()
+
+	if task := state.snapshot(); task.CallbackURL != "" {
+		go s.deliverCallback(task)
+	}
+}
 
-	task = s.createTask(sellerId)
+func (s *TaskServiceImpl) StartUploadingTask(sellerId uint64, xlsxURL string, opts TaskOptions) (task *Task, err error) {
 
-	go func() {
-		req, err := http.Get(xlsxURL)
-		if err != nil {
-			log.Error(err)
-			task.SetStatus(fmt.Sprintf("Error occured: %s", err), http.StatusBadRequest)
-			return
-		}
+	task, _, err = s.enqueueTask(Task{SellerId: sellerId, URL: xlsxURL}, opts, s.runUploadingTask)
+	return task, err
+}
 
-		defer req.Body.Close()
-		body, err := ioutil.ReadAll(req.Body)
-		if err != nil {
-			task.SetStatus(fmt.Sprintf("Error occured: %s", err), http.StatusBadRequest)
-			return
-		}
-		xlsxFile, err := xlsx.OpenBinary(body)
-		if err != nil {
-			task.SetStatus(fmt.Sprintf("Error occured: %s", err), http.StatusBadRequest)
-			return
+// StartUploadingFileTask сохраняет загруженную таблицу во временный каталог и ставит задание на ее обработку в очередь
+func (s *TaskServiceImpl) StartUploadingFileTask(sellerId uint64, upload UploadedFile, opts TaskOptions) (*Task, error) {
+	file, err := spoolFile(s.cfg.SpoolDir, upload.Body, int64(s.cfg.MaxFileSize))
+	if err != nil {
+		return nil, err
+	}
+	file.name = upload.Name
+	file.contentType = upload.ContentType
+
+	task, enqueued, err := s.enqueueTask(Task{SellerId: sellerId, FileName: upload.Name}, opts, func(state *taskState) {
+		s.runUploadedFileTask(state, file)
+	})
+	// Файл удаляет задание, а если оно не создано или уже было создано с тем же ключом - удаляем сразу
+	if !enqueued {
+		file.remove()
+	}
+	return task, err
+}
+
+// CancelTask отменяет задание. Ожидающее в очереди задание отменяется сразу,
+// выполняющееся - остановится на следующей строке, сохранив счетчики
+func (s *TaskServiceImpl) CancelTask(id string) (*Task, error) {
+	s.mu.RLock()
+	state, ok := s.active[id]
+	s.mu.RUnlock()
+	if !ok {
+		if _, found := s.GetTask(id); found {
+			return nil, ErrTaskFinished
 		}
-		task.SetStatus("Parsing", http.StatusProcessing)
-		ParsingTask(xlsxFile, task, s.repo)
-	}()
+		return nil, ErrTaskNotFound
+	}
 
-	return task, nil
+	state.cancel()
+	if state.transition(http.StatusAccepted, models.TaskStatusCancelled, models.StatusClientClosedRequest) {
+		s.finishTask(state)
+	}
+	return s.snapshot(state), nil
+}
+
+func (s *TaskServiceImpl) runUploadingTask(state *taskState) {
+	// Задание могли отменить, пока оно ждало в очереди
+	if !state.transition(http.StatusAccepted, models.TaskStatusDownloading, http.StatusProcessing) {
+		return
+	}
+	defer s.finishTask(state)
+
+	file, err := downloadFile(state.ctx, state.url(), s.cfg.SpoolDir, int64(s.cfg.MaxFileSize))
+	if err != nil {
+		log.Error(err)
+		state.fail(err)
+		return
+	}
+	defer file.remove()
+
+	s.importFile(state, file)
+}
+
+func (s *TaskServiceImpl) runUploadedFileTask(state *taskState, file *spooledFile) {
+	// Файл удаляется, даже если задание отменили, пока оно ждало в очереди
+	if !state.transition(http.StatusAccepted, models.TaskStatusParsing, http.StatusProcessing) {
+		file.remove()
+		return
+	}
+	defer s.finishTask(state)
+	defer file.remove()
+
+	s.importFile(state, file)
+}
+
+// importFile разбирает сохраненную таблицу и применяет ее строки
+func (s *TaskServiceImpl) importFile(state *taskState, file *spooledFile) {
+	format := detectFormat(state.opts.Format, file)
+	hash := importHash(file.hash, format, state.opts)
+	state.update(func(t *Task) {
+		t.Format = format
+		t.ContentHash = hash
+	})
+	// Продавец прислал тот же файл, что и в прошлый раз: строки уже применены
+	if previous := s.findUnchangedImport(state, hash); previous != nil {
+		state.update(func(t *Task) { t.PreviousTaskId = previous.Id })
+		state.setStatus(models.TaskStatusNoChanges, http.StatusOK)
+		return
+	}
+
+	// Строки считаются заранее, чтобы отклонить слишком большую таблицу до того, как что-то записано в базу
+	sheets, err := openTable(format, file, state.opts)
+	if err != nil {
+		state.fail(err)
+		return
+	}
+	defer closeSheets(sheets)
+	total := 0
+	for _, sheet := range sheets {
+		total += sheet.total
+	}
+	if s.cfg.MaxRows > 0 && total > s.cfg.MaxRows {
+		state.fail(fmt.Errorf("%w: %d rows, limit is %d", ErrTooManyRows, total, s.cfg.MaxRows))
+		return
+	}
+	if state.opts.Sheet == AllSheets {
+		state.update(func(t *Task) {
+			t.Info.Sheets = make(models.SheetsInfo, len(sheets))
+			for i, sheet := range sheets {
+				t.Info.Sheets[i].Name = sheet.name
+			}
+		})
+	}
+
+	state.setTotal(total)
+	state.setStatus(models.TaskStatusParsing, http.StatusProcessing)
+	parser := rowParser{decimalSeparator: state.opts.DecimalSeparator, numericCells: format == FormatXLSX}
+	parsingTask(state.ctx, sheets, parser, total, state, s.repo)
 }
 
 type RowData struct {
@@ -96,10 +273,18 @@ type RowData struct {
 		Quantity  int    `xlsx:"3"`
 		Available bool   `xlsx:"4"`
 	}
-	ok  bool
-	err error
+	// Лист, из которого строка, и номер строки в нем, начиная с 1
+	Sheet string
+	Row   int
+	// Удалось ли разобрать offer_id, даже если в остальных ячейках ошибки
+	hasOfferId bool
+	ok         bool
+	err        *models.TaskRowError
 }
 
+// Колонки товара. В таблице они находятся по заголовку, в ошибках строк указываются эти названия
+var columnNames = [...]string{"offer_id", "name", "price", "quantity", "available"}
+
 func (r *RowData) UpdateColumns(offerId uint64, name string, price int64, quantity int, available bool) {
 	r.Columns.OfferId = offerId
 	r.Columns.Name = name
@@ -108,133 +293,372 @@ func (r *RowData) UpdateColumns(offerId uint64, name string, price int64, quanti
 	r.Columns.Available = available
 }
 
-func ParsingTask(wb *xlsx.File, task *Task, repo repositories.Repository) {
-	sh := wb.Sheets[0]
+// setError помечает строку ошибочной. Сохраняется только первая ошибка в строке
+func (r *RowData) setError(column int, reason string, value string, err error) {
+	r.ok = false
+	if r.err != nil {
+		return
+	}
+	r.err = &models.TaskRowError{Sheet: r.Sheet, Row: r.Row, Reason: reason, Value: value}
+	if column >= 0 {
+		r.err.Column = columnNames[column]
+	}
+	if err != nil {
+		r.err.Message = err.Error()
+	}
+}
+
+// Сколько разобранных строк может ждать записи в базу
+const parsedRowsBufferSize = 1000
 
-	rows := sh.Rows
-	if len(rows) < 2 {
-		task.SetStatus("Too few rows", http.StatusBadRequest)
+// parsingTask разбирает total строк с товарами со всех листов и применяет их
+func parsingTask(ctx context.Context, sheets []tableSheet, parser rowParser, total int, state *taskState, repo repositories.Repository) {
+	if total < 1 {
+		state.setStatus("Too few rows", http.StatusBadRequest)
 		return
 	}
-	rows = sh.Rows[1:]
-	parsedRows := make(chan RowData, len(rows))
-	defer close(parsedRows)
+	parsedRows := make(chan RowData, parsedRowsBufferSize)
+
+	// Разбор строк останавливается и при отмене задания, и при досрочном выходе из обработки
+	rowsCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	var readErr error
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		defer close(parsedRows)
+		readErr = parsingRows(rowsCtx, parsedRows, sheets, parser)
+	}()
 
-	go checkAndUploadRows(parsedRows, task, repo)
-	parsingRows(parsedRows, rows)
+	var err error
+	if state.opts.Atomic && !state.opts.DryRun {
+		err = repo.Transaction(func(txRepo repositories.Repository) error {
+			writer := repoWriter{repo: txRepo}
+			if err := checkAndUploadRows(ctx, parsedRows, state, txRepo, writer); err != nil {
+				return err
+			}
+			if readErr != nil {
+				return readErr
+			}
+			if state.errorRatio(total) > state.opts.MaxErrorRatio {
+				return errTooManyErrors
+			}
+			return deleteMissingOffers(ctx, state, txRepo, writer)
+		})
+		if err != nil {
+			state.discardCounts()
+		}
+	} else {
+		writer := state.writer(repo)
+		err = checkAndUploadRows(ctx, parsedRows, state, repo, writer)
+		if err == nil {
+			err = readErr
+		}
+		if err == nil {
+			err = deleteMissingOffers(ctx, state, repo, writer)
+		}
+	}
+	// Обработка могла закончиться раньше таблицы, дожидаемся остановки чтения
+	stop()
+	<-readDone
+	state.flushRowErrors()
+	state.attachPreview()
+
+	switch {
+	case ctx.Err() != nil:
+		state.setStatus(models.TaskStatusCancelled, models.StatusClientClosedRequest)
+	case err != nil && err == readErr && !state.opts.Atomic:
+		// Файл оказался поврежден посередине, уже записанные строки остаются
+		state.fail(err)
+	case err != nil:
+		log.Debug(err)
+		state.setStatus(models.TaskStatusRolledBack, http.StatusUnprocessableEntity)
+	default:
+		state.setStatus(models.TaskStatusCompleted, http.StatusOK)
+	}
 }
 
-func parsingRows(parsedRows chan<- RowData, rows []*xlsx.Row) {
-	for _, row := range rows {
-		rowData := RowData{}
-		rowData.ok = true
-		cells := row.Cells
-		if len(cells) >= 5 {
-			offerIdStr, err := cells[0].GeneralNumericWithoutScientific()
+var errTooManyErrors = errors.New("error ratio exceeds the threshold")
+
+// parsingRows читает строки листов по очереди до конца таблицы. Возвращает ошибку чтения, если файл поврежден
+func parsingRows(ctx context.Context, parsedRows chan<- RowData, sheets []tableSheet, parser rowParser) error {
+	for _, sheet := range sheets {
+		sheetParser := parser
+		sheetParser.columns = sheet.columns
+		sheetParser.sheet = sheet.name
+		for {
+			cells, rowNumber, err := sheet.reader.Next()
+			if err == io.EOF {
+				break
+			}
 			if err != nil {
-				rowData.err = err
-				rowData.ok = false
+				return err
 			}
+			rowData := sheetParser.parseRow(cells, rowNumber)
 
-			offerId, err := strconv.ParseUint(offerIdStr, 10, 64)
-			if err != nil {
-				rowData.err = err
-				rowData.ok = false
+			select {
+			case parsedRows <- rowData:
+			case <-ctx.Done():
+				return nil
 			}
+		}
+	}
+	return nil
+}
 
-			name := cells[1].String()
+// numericWithoutScientific приводит число из ячейки к записи без экспоненты, как xlsx.Cell.GeneralNumericWithoutScientific
+func numericWithoutScientific(value string) (string, error) {
+	if strings.TrimSpace(value) == "" {
+		return "", nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value, err
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64), nil
+}
 
-			priceStr, err := cells[2].GeneralNumericWithoutScientific()
-			if err != nil {
-				rowData.err = err
-				rowData.ok = false
-			}
+// rowParser разбирает значения ячеек строки
+type rowParser struct {
+	// Номера ячеек с колонками товара, найденные по заголовку листа, и имя листа для ошибок строк
+	columns columnMapping
+	sheet   string
+	// Разделитель дробной части в числах, 0 - точка
+	decimalSeparator rune
+	// Числа в ячейках xlsx хранятся как double и могут быть записаны с экспонентой
+	numericCells bool
+}
 
-			price, err := strconv.ParseInt(priceStr, 10, 64)
-			if err != nil {
-				rowData.err = err
-				rowData.ok = false
-			}
+// offerId разбирает offer_id. Целое число разбирается точно: через float64 id больше 2^53 изменился бы,
+// и строка попала бы в чужой товар. Запись с экспонентой допускается только в числовых ячейках xlsx
+func (p rowParser) offerId(value string) (uint64, error) {
+	offerId, err := strconv.ParseUint(value, 10, 64)
+	if err == nil || !p.numericCells {
+		return offerId, err
+	}
+	value, err = numericWithoutScientific(p.number(value))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
 
-			quantity, err := cells[3].Int()
-			if err != nil {
-				rowData.err = err
-				rowData.ok = false
-			}
+// price разбирает цену. Целое число разбирается точно, иначе - как число с дробной частью или экспонентой
+func (p rowParser) price(value string) (int64, error) {
+	if price, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return price, nil
+	}
+	value, err := numericWithoutScientific(p.number(value))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
 
-			availableStr, err := cells[4].FormattedValue()
-			if err != nil {
-				rowData.err = err
-				rowData.ok = false
-			}
+// number приводит число из ячейки к записи с точкой в качестве разделителя дробной части
+func (p rowParser) number(value string) string {
+	if p.decimalSeparator == 0 || p.decimalSeparator == '.' {
+		return value
+	}
+	return strings.Replace(value, string(p.decimalSeparator), ".", 1)
+}
 
-			available, err := strconv.ParseBool(availableStr)
-			if err != nil {
-				rowData.err = err
-				rowData.ok = false
-			}
+func (p rowParser) parseRow(row []string, rowNumber int) RowData {
+	rowData := RowData{Sheet: p.sheet, Row: rowNumber}
+	rowData.ok = true
+	if need := p.columns.cells(); len(row) < need {
+		rowData.setError(-1, models.RowErrorMissingCells, "",
+			fmt.Errorf("expected %d cells, got %d", need, len(row)))
+		return rowData
+	}
+	// Ячейки в порядке columnNames
+	var cells [len(columnNames)]string
+	for i, cell := range p.columns {
+		cells[i] = row[cell]
+	}
 
-			if rowData.ok {
-				rowData.UpdateColumns(offerId, name, price, quantity, available)
-			}
+	offerId, err := p.offerId(cells[0])
+	if err != nil {
+		rowData.setError(0, models.RowErrorBadOfferId, cells[0], err)
+	} else {
+		rowData.Columns.OfferId = offerId
+		rowData.hasOfferId = true
+	}
 
-			if rowData.Columns.Price < 0 || rowData.Columns.Quantity < 0 {
-				rowData.ok = false
-			}
+	name := cells[1]
 
-		} else {
-			rowData.ok = false
-		}
+	price, err := p.price(cells[2])
+	if err != nil {
+		rowData.setError(2, models.RowErrorBadPrice, cells[2], err)
+	}
+
+	quantityFloat, err := strconv.ParseFloat(p.number(cells[3]), 64)
+	if err != nil {
+		rowData.setError(3, models.RowErrorBadQuantity, cells[3], err)
+	}
+	quantity := int(quantityFloat)
+
+	available, err := strconv.ParseBool(cells[4])
+	if err != nil {
+		rowData.setError(4, models.RowErrorBadAvailable, cells[4], err)
+	}
+
+	if rowData.ok {
+		rowData.UpdateColumns(offerId, name, price, quantity, available)
+	}
+
+	if rowData.Columns.Price < 0 {
+		rowData.setError(2, models.RowErrorNegativePrice, cells[2], nil)
+	}
+	if rowData.Columns.Quantity < 0 {
+		rowData.setError(3, models.RowErrorNegativeQuantity, cells[3], nil)
+	}
+
+	return rowData
+}
 
-		parsedRows <- rowData
+// dbFailure формирует ошибку строки, которую не удалось записать в базу
+func dbFailure(row RowData, err error) models.TaskRowError {
+	return models.TaskRowError{
+		Sheet:   row.Sheet,
+		Row:     row.Row,
+		Column:  columnNames[0],
+		Value:   strconv.FormatUint(row.Columns.OfferId, 10),
+		Reason:  models.RowErrorDbFailure,
+		Message: err.Error(),
 	}
 }
 
-func checkAndUploadRows(parsedRows <-chan RowData, task *Task, repo repositories.Repository) {
-	defer task.SetStatus("Completed", http.StatusOK)
-	sellerId := task.SellerId
+func checkAndUploadRows(ctx context.Context, parsedRows <-chan RowData, state *taskState, repo repositories.Repository, writer offerWriter) error {
+	sellerId := state.sellerId()
+	batch := state.batch(repo)
+	processed := 0
+	// Итоговое количество сообщается и при досрочном выходе
+	defer func() { state.setProcessed(processed) }()
 	for parsedRow := range parsedRows {
-		if !parsedRow.ok {
-			task.Info.Errors++
-			if parsedRow.err != nil {
-				log.Debug(parsedRow.err)
+		if ctx.Err() != nil {
+			// Уже прочитанные строки записываются, чтобы счетчики совпадали с базой
+			if batch != nil && !state.opts.Atomic {
+				batch.flush()
 			}
+			return ctx.Err()
+		}
+		processed++
+		if processed%progressSaveInterval == 0 {
+			state.setProcessed(processed)
+			state.save()
+			state.flushRowErrors()
+		}
+		if parsedRow.hasOfferId {
+			state.markSeen(parsedRow.Columns.OfferId)
+		}
+		if !parsedRow.ok {
+			state.addRowError(*parsedRow.err)
 			continue
 		}
 
-		offerId := parsedRow.Columns.OfferId
-		offer, err := repo.FindOffer(offerId, uint64(sellerId))
-		if err == gorm.ErrRecordNotFound {
-			if parsedRow.Columns.Available == false {
-				continue
+		if batch != nil {
+			if err := batch.add(parsedRow); err != nil && state.opts.Atomic {
+				return err
 			}
-			offer, err = repo.NewOffer(offerId, uint64(sellerId), parsedRow.Columns.Name, parsedRow.Columns.Price, parsedRow.Columns.Quantity, parsedRow.Columns.Available)
-			if err != nil {
-				task.Info.Errors++
-				log.Debug(err)
-				continue
-			}
-			task.Info.Created++
-		} else if err == nil && offer != nil {
-			if parsedRow.Columns.Available == false {
-				repo.Delete(offer)
-				task.Info.Deleted++
-				continue
+			continue
+		}
+		if err := uploadRow(parsedRow, sellerId, state, repo, writer); err != nil {
+			state.addRowError(dbFailure(parsedRow, err))
+			// После ошибки транзакция уже непригодна, продолжать нет смысла
+			if state.opts.Atomic {
+				return err
 			}
+		}
+	}
+	if batch != nil {
+		if err := batch.flush(); err != nil && state.opts.Atomic {
+			return err
+		}
+	}
+	return nil
+}
 
-			err := repo.UpdateColumns(offer, parsedRow.Columns.Name, parsedRow.Columns.Price, parsedRow.Columns.Quantity, parsedRow.Columns.Available)
-			if err != nil {
-				task.Info.Errors++
-				log.Debug(err)
-				continue
-			}
-			task.Info.Updated++
-		} else {
-			task.Info.Errors++
-			if err != nil {
-				log.Debug(err)
-			}
+// deleteMissingOffers в режиме полной синхронизации удаляет товары продавца, которых не было в таблице
+func deleteMissingOffers(ctx context.Context, state *taskState, repo repositories.Repository, writer offerWriter) error {
+	if state.opts.Mode != ModeFullSync || ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	sellerId := state.sellerId()
+	offers, err := repo.FindOffers(repositories.OfferQuery{SellerId: &sellerId})
+	if err != nil {
+		return err
+	}
+	if state.batch(repo) != nil {
+		return deleteMissingOffersBatched(state, repo, offers)
+	}
+	for i := range offers {
+		if state.wasSeen(offers[i].OfferId) {
+			continue
+		}
+		if err := writer.delete(&offers[i]); err != nil {
+			return err
+		}
+		state.addCounts("", 0, 0, 1)
+	}
+	return nil
+}
+
+// deleteMissingOffersBatched удаляет отсутствующие в таблице товары пачками по batchSize
+func deleteMissingOffersBatched(state *taskState, repo repositories.Repository, offers []models.Offer) error {
+	var missing []uint64
+	for i := range offers {
+		if !state.wasSeen(offers[i].OfferId) {
+			missing = append(missing, offers[i].OfferId)
 		}
 	}
+	for len(missing) > 0 {
+		n := state.batchSize
+		if n > len(missing) {
+			n = len(missing)
+		}
+		deleted, err := repo.DeleteOffers(state.sellerId(), missing[:n])
+		if err != nil {
+			return err
+		}
+		state.addCounts("", 0, 0, int(deleted))
+		missing = missing[n:]
+	}
+	return nil
+}
 
+// uploadRow решает, что делать с товаром из строки, и применяет решение через writer
+func uploadRow(parsedRow RowData, sellerId uint64, state *taskState, repo repositories.Repository, writer offerWriter) error {
+	offer, err := repo.FindOffer(parsedRow.Columns.OfferId, sellerId)
+	if err == gorm.ErrRecordNotFound {
+		if parsedRow.Columns.Available == false {
+			return nil
+		}
+		if err := writer.create(sellerId, parsedRow); err != nil {
+			return err
+		}
+		state.addCounts(parsedRow.Sheet, 1, 0, 0)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if offer == nil {
+		return gorm.ErrRecordNotFound
+	}
+
+	if parsedRow.Columns.Available == false {
+		if err := writer.delete(offer); err != nil {
+			return err
+		}
+		state.addCounts(parsedRow.Sheet, 0, 0, 1)
+		return nil
+	}
+
+	if err := writer.update(offer, parsedRow); err != nil {
+		return err
+	}
+	state.addCounts(parsedRow.Sheet, 0, 1, 0)
+	return nil
 }
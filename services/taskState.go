@@ -0,0 +1,235 @@
+package services
+
+import (
+	"MartellX/avito-tech-task/models"
+	"MartellX/avito-tech-task/repositories"
+	"context"
+	"fmt"
+	"github.com/labstack/gommon/log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// taskState владеет состоянием выполняющегося задания.
+// Все изменения проходят под мьютексом, наружу отдаются только копии
+type taskState struct {
+	mu   sync.RWMutex
+	task Task
+	repo repositories.Repository
+
+	// Порядковый номер постановки в очередь и параметры задания, не меняются после создания
+	queueSeq  uint64
+	opts      TaskOptions
+	batchSize int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Ошибки строк, еще не записанные в базу
+	rowErrors []models.TaskRowError
+	// Результат пробного запуска, заполняется воркером и попадает в задание при завершении
+	preview *models.TaskPreview
+	// offer_id, встретившиеся в таблице. Заполняется только воркером в режиме полной синхронизации
+	seen map[uint64]struct{}
+
+	// Подписчики на события задания. После завершения новые подписчики получают только итоговое событие
+	subscribers map[chan TaskEvent]struct{}
+	finished    bool
+}
+
+func newTaskState(task Task, repo repositories.Repository, queueSeq uint64, opts TaskOptions, batchSize int) *taskState {
+	ctx, cancel := context.WithCancel(context.Background())
+	state := &taskState{task: task, repo: repo, queueSeq: queueSeq, opts: opts, batchSize: batchSize, ctx: ctx, cancel: cancel}
+	if opts.DryRun {
+		state.preview = &models.TaskPreview{}
+	}
+	if opts.Mode == ModeFullSync {
+		state.seen = map[uint64]struct{}{}
+	}
+	return state
+}
+
+func (ts *taskState) id() string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.task.Id
+}
+
+func (ts *taskState) url() string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.task.URL
+}
+
+func (ts *taskState) sellerId() uint64 {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.task.SellerId
+}
+
+// snapshot возвращает неизменяемую копию текущего состояния задания
+func (ts *taskState) snapshot() *Task {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	task := ts.task
+	// Счетчики листов меняются под мьютексом, копия не должна делить с ними память
+	task.Info.Sheets = append(models.SheetsInfo(nil), ts.task.Info.Sheets...)
+	return &task
+}
+
+func (ts *taskState) update(fn func(t *Task)) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	fn(&ts.task)
+}
+
+func (ts *taskState) setStatus(status string, code int) {
+	ts.mu.Lock()
+	ts.task.SetStatus(status, code)
+	ts.publish(EventStatus)
+	ts.mu.Unlock()
+
+	ts.save()
+}
+
+// transition меняет статус, только если текущий код равен fromCode. Возвращает, произошла ли смена
+func (ts *taskState) transition(fromCode int, status string, code int) bool {
+	ts.mu.Lock()
+	if ts.task.StatusCode != fromCode {
+		ts.mu.Unlock()
+		return false
+	}
+	ts.task.SetStatus(status, code)
+	// Задание берет воркер, только он переводит его из очереди
+	if fromCode == http.StatusAccepted && ts.task.StartedAt == nil {
+		now := time.Now()
+		ts.task.StartedAt = &now
+	}
+	ts.publish(EventStatus)
+	ts.mu.Unlock()
+
+	ts.save()
+	return true
+}
+
+// fail выставляет статус ошибки, а если задание было отменено - статус Cancelled
+func (ts *taskState) fail(err error) {
+	if ts.ctx.Err() != nil {
+		ts.setStatus(models.TaskStatusCancelled, models.StatusClientClosedRequest)
+		return
+	}
+	ts.setStatus(fmt.Sprintf("Error occured: %s", err), http.StatusBadRequest)
+}
+
+// addRowError учитывает ошибку строки в счетчике и откладывает ее для записи в базу
+func (ts *taskState) addRowError(rowError models.TaskRowError) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	rowError.TaskId = ts.task.Id
+	ts.task.Info.Errors++
+	if rowError.Reason == models.RowErrorDbFailure {
+		ts.task.DbFailures++
+	}
+	if sheet := ts.task.Info.Sheets.Sheet(rowError.Sheet); sheet != nil {
+		sheet.Errors++
+	}
+	ts.rowErrors = append(ts.rowErrors, rowError)
+	if ts.preview != nil {
+		ts.preview.Errors = append(ts.preview.Errors, rowError)
+	}
+}
+
+// addCounts прибавляет созданные, обновленные и удаленные товары к счетчикам задания и листа sheet
+func (ts *taskState) addCounts(sheet string, created, updated, deleted int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	info := &ts.task.Info
+	info.Created += created
+	info.Updated += updated
+	info.Deleted += deleted
+	if sheetInfo := info.Sheets.Sheet(sheet); sheetInfo != nil {
+		sheetInfo.Created += created
+		sheetInfo.Updated += updated
+		sheetInfo.Deleted += deleted
+	}
+}
+
+// discardCounts обнуляет счетчики созданных, обновленных и удаленных товаров, когда транзакция откатилась
+// и записи не сохранились. Ошибки строк остаются
+func (ts *taskState) discardCounts() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	info := &ts.task.Info
+	info.Created, info.Updated, info.Deleted = 0, 0, 0
+	for i := range info.Sheets {
+		info.Sheets[i].Created, info.Sheets[i].Updated, info.Sheets[i].Deleted = 0, 0, 0
+	}
+}
+
+func (ts *taskState) markSeen(offerId uint64) {
+	if ts.seen != nil {
+		ts.seen[offerId] = struct{}{}
+	}
+}
+
+func (ts *taskState) wasSeen(offerId uint64) bool {
+	_, ok := ts.seen[offerId]
+	return ok
+}
+
+// errorRatio возвращает долю ошибочных строк среди total строк таблицы
+func (ts *taskState) errorRatio(total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return float64(ts.task.Info.Errors) / float64(total)
+}
+
+// writer возвращает, куда применять изменения по строкам
+func (ts *taskState) writer(repo repositories.Repository) offerWriter {
+	if ts.preview != nil {
+		return previewWriter{preview: ts.preview}
+	}
+	return repoWriter{repo: repo}
+}
+
+// batch возвращает пачку для записи товаров или nil, если строки записываются по одной
+func (ts *taskState) batch(repo repositories.Repository) *offerBatch {
+	if ts.batchSize <= 0 || ts.preview != nil {
+		return nil
+	}
+	return newOfferBatch(ts.batchSize, ts, repo)
+}
+
+// attachPreview добавляет результат пробного запуска в задание
+func (ts *taskState) attachPreview() {
+	if ts.preview == nil {
+		return
+	}
+	ts.update(func(t *Task) {
+		t.Preview = ts.preview
+	})
+}
+
+func (ts *taskState) flushRowErrors() {
+	ts.mu.Lock()
+	rowErrors := ts.rowErrors
+	ts.rowErrors = nil
+	ts.mu.Unlock()
+
+	if len(rowErrors) == 0 {
+		return
+	}
+	if err := ts.repo.CreateTaskRowErrors(rowErrors); err != nil {
+		log.Error(err)
+	}
+}
+
+func (ts *taskState) save() {
+	if err := ts.repo.SaveTask(ts.snapshot()); err != nil {
+		log.Error(err)
+	}
+}
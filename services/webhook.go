@@ -0,0 +1,83 @@
+package services
+
+import (
+	"MartellX/avito-tech-task/models"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/gommon/log"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Заголовок с подписью тела запроса: sha256=<hex HMAC-SHA256 с секретом WebhookSecret>
+const SignatureHeader = "X-Signature"
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// SignPayload возвращает значение заголовка SignatureHeader для тела body
+func SignPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverCallback отправляет завершенное задание на его callback_url. Неудачные попытки повторяются
+// с экспоненциальной задержкой, каждая попытка сохраняется в задании
+func (s *TaskServiceImpl) deliverCallback(task *Task) {
+	body, err := json.Marshal(task)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	delay := s.cfg.WebhookBackoff
+	for i := 1; i <= s.cfg.WebhookAttempts; i++ {
+		attempt := postCallback(task.CallbackURL, task.Id, body, s.cfg.WebhookSecret)
+		// Завершенное задание больше никто не меняет, поэтому его можно сохранять целиком
+		task.CallbackAttempts = append(task.CallbackAttempts, attempt)
+		if err := s.repo.SaveTask(task); err != nil {
+			log.Error(err)
+		}
+		if attempt.Error == "" {
+			return
+		}
+		if i < s.cfg.WebhookAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+}
+
+func postCallback(url string, taskId string, body []byte, secret string) models.CallbackAttempt {
+	attempt := models.CallbackAttempt{At: time.Now()}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Task-Id", taskId)
+	if secret != "" {
+		req.Header.Set(SignatureHeader, SignPayload(secret, body))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("unexpected response status %s", resp.Status)
+	}
+	return attempt
+}
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/tealeg/xlsx"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// rowReader отдает строки таблицы по одной, не загружая таблицу в память целиком
+type rowReader interface {
+	// Next возвращает значения ячеек следующей строки и ее номер в таблице, начиная с 1.
+	// После последней строки возвращает io.EOF
+	Next() (cells []string, rowNumber int, err error)
+	Close() error
+}
+
+// xlsxWorkbook - открытая книга xlsx: список листов и общие строки, на которые ссылаются текстовые ячейки
+type xlsxWorkbook struct {
+	sheets        []xlsxSheet
+	sharedStrings []string
+}
+
+type xlsxSheet struct {
+	name string
+	file *zip.File
+}
+
+// xlsxReader читает лист xlsx потоком: в памяти держатся только общие строки книги и текущая строка листа
+type xlsxReader struct {
+	sheetFile     *zip.File
+	sharedStrings []string
+
+	sheet   io.ReadCloser
+	decoder *xml.Decoder
+	// Номер последней отданной строки и строка, прочитанная с опережением, если в листе был пропуск
+	lastRow int
+	ahead   *xlsxRow
+}
+
+type xlsxRow struct {
+	R     int `xml:"r,attr"`
+	Cells []struct {
+		R  string `xml:"r,attr"`
+		T  string `xml:"t,attr"`
+		V  string `xml:"v"`
+		Is *struct {
+			T string `xml:"t"`
+			R []struct {
+				T string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"is"`
+	} `xml:"c"`
+}
+
+type xlsxSharedString struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (s xlsxSharedString) text() string {
+	if len(s.R) == 0 {
+		return s.T
+	}
+	var b strings.Builder
+	for _, r := range s.R {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+var (
+	errNoSheets      = errors.New("xlsx: workbook has no sheets")
+	ErrSheetNotFound = errors.New("sheet not found")
+)
+
+func openXlsxWorkbook(r io.ReaderAt, size int64) (*xlsxWorkbook, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	rels, err := readWorkbookRels(files)
+	if err != nil {
+		return nil, err
+	}
+	wb := &xlsxWorkbook{}
+	if wb.sheets, err = readSheets(files, rels); err != nil {
+		return nil, err
+	}
+	if f, ok := files[relsTarget(rels, "sharedStrings", "xl/sharedStrings.xml")]; ok {
+		if wb.sharedStrings, err = readSharedStrings(f); err != nil {
+			return nil, err
+		}
+	}
+	return wb, nil
+}
+
+// selectSheets возвращает номера листов для импорта: первый лист, если selector пуст,
+// все листы для AllSheets, иначе лист с таким именем или номером, начиная с 1
+func (wb *xlsxWorkbook) selectSheets(selector string) ([]int, error) {
+	switch selector {
+	case "":
+		return []int{0}, nil
+	case AllSheets:
+		all := make([]int, len(wb.sheets))
+		for i := range wb.sheets {
+			all[i] = i
+		}
+		return all, nil
+	}
+	for i, sheet := range wb.sheets {
+		if sheet.name == selector {
+			return []int{i}, nil
+		}
+	}
+	for i, sheet := range wb.sheets {
+		if strings.EqualFold(sheet.name, selector) {
+			return []int{i}, nil
+		}
+	}
+	if n, err := strconv.Atoi(selector); err == nil && n >= 1 && n <= len(wb.sheets) {
+		return []int{n - 1}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrSheetNotFound, selector)
+}
+
+// openSheet открывает чтение листа с номером i
+func (wb *xlsxWorkbook) openSheet(i int) (*xlsxReader, error) {
+	sheet := wb.sheets[i]
+	if sheet.file == nil {
+		return nil, fmt.Errorf("xlsx: sheet %q not found", sheet.name)
+	}
+	reader := &xlsxReader{sheetFile: sheet.file, sharedStrings: wb.sharedStrings}
+	if err := reader.open(); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (r *xlsxReader) open() error {
+	sheet, err := r.sheetFile.Open()
+	if err != nil {
+		return err
+	}
+	r.sheet = sheet
+	r.decoder = xml.NewDecoder(sheet)
+	return nil
+}
+
+// countRows считает строки листа отдельным проходом, не разбирая ячейки.
+// Пропущенные в листе строки считаются так же, как их отдает Next
+func (r *xlsxReader) countRows() (int, error) {
+	sheet, err := r.sheetFile.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer sheet.Close()
+
+	count, lastRow := 0, 0
+	decoder := xml.NewDecoder(sheet)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "row" {
+			rowNumber := lastRow + 1
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "r" {
+					if n, err := strconv.Atoi(attr.Value); err == nil && n > 0 {
+						rowNumber = n
+					}
+				}
+			}
+			if rowNumber > lastRow+1 {
+				count += rowNumber - lastRow
+			} else {
+				count++
+			}
+			lastRow = rowNumber
+			if err := decoder.Skip(); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+func (r *xlsxReader) Next() ([]string, int, error) {
+	row := r.ahead
+	r.ahead = nil
+	if row == nil {
+		var err error
+		if row, err = r.nextRow(); err != nil {
+			return nil, 0, err
+		}
+	}
+	if row.R == 0 {
+		row.R = r.lastRow + 1
+	}
+
+	// Пропущенные в листе строки отдаются пустыми, чтобы номера строк совпадали с таблицей
+	if row.R > r.lastRow+1 {
+		r.ahead = row
+		r.lastRow++
+		return nil, r.lastRow, nil
+	}
+	r.lastRow = row.R
+	return r.cells(row), row.R, nil
+}
+
+func (r *xlsxReader) nextRow() (*xlsxRow, error) {
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "row" {
+			var row xlsxRow
+			if err := r.decoder.DecodeElement(&row, &start); err != nil {
+				return nil, err
+			}
+			return &row, nil
+		}
+	}
+}
+
+// cells переводит ячейки строки в значения так же, как их хранит xlsx.Cell.Value
+func (r *xlsxReader) cells(row *xlsxRow) []string {
+	var cells []string
+	for _, c := range row.Cells {
+		column := len(cells)
+		if c.R != "" {
+			if x, _, err := xlsx.GetCoordsFromCellIDString(c.R); err == nil && x >= column {
+				column = x
+			}
+		}
+		for len(cells) < column {
+			cells = append(cells, "")
+		}
+
+		value := strings.Trim(c.V, " \t\n\r")
+		switch c.T {
+		case "s":
+			if idx, err := strconv.Atoi(value); err == nil && idx >= 0 && idx < len(r.sharedStrings) {
+				value = r.sharedStrings[idx]
+			}
+		case "inlineStr":
+			value = ""
+			if c.Is != nil {
+				value = xlsxSharedString{T: c.Is.T, R: c.Is.R}.text()
+			}
+		}
+		cells = append(cells, value)
+	}
+	return cells
+}
+
+func (r *xlsxReader) Close() error {
+	return r.sheet.Close()
+}
+
+type xlsxRelationship struct {
+	Id     string `xml:"Id,attr"`
+	Type   string `xml:"Type,attr"`
+	Target string `xml:"Target,attr"`
+}
+
+func readWorkbookRels(files map[string]*zip.File) ([]xlsxRelationship, error) {
+	f, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok {
+		return nil, nil
+	}
+	var rels struct {
+		Relationships []xlsxRelationship `xml:"Relationship"`
+	}
+	if err := decodeZipFile(f, &rels); err != nil {
+		return nil, err
+	}
+	return rels.Relationships, nil
+}
+
+// relsTarget возвращает путь к части книги с типом, оканчивающимся на relType
+func relsTarget(rels []xlsxRelationship, relType string, def string) string {
+	for _, rel := range rels {
+		if strings.HasSuffix(rel.Type, "/"+relType) {
+			return zipPath(rel.Target)
+		}
+	}
+	return def
+}
+
+func zipPath(target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Join("xl", target)
+}
+
+// readSheets возвращает листы книги в порядке их следования
+func readSheets(files map[string]*zip.File, rels []xlsxRelationship) ([]xlsxSheet, error) {
+	f, ok := files["xl/workbook.xml"]
+	if !ok {
+		return nil, errors.New("xlsx: workbook.xml not found")
+	}
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			Id   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeZipFile(f, &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, errNoSheets
+	}
+
+	sheets := make([]xlsxSheet, len(workbook.Sheets))
+	for i, sheet := range workbook.Sheets {
+		sheetPath := fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		for _, rel := range rels {
+			if rel.Id == sheet.Id {
+				sheetPath = zipPath(rel.Target)
+				break
+			}
+		}
+		sheets[i] = xlsxSheet{name: sheet.Name, file: files[sheetPath]}
+	}
+	return sheets, nil
+}
+
+func readSharedStrings(f *zip.File) ([]string, error) {
+	var sst struct {
+		Items []xlsxSharedString `xml:"si"`
+	}
+	if err := decodeZipFile(f, &sst); err != nil {
+		return nil, err
+	}
+	result := make([]string, len(sst.Items))
+	for i, item := range sst.Items {
+		result[i] = item.text()
+	}
+	return result, nil
+}
+
+func decodeZipFile(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}